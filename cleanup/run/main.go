@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+
+	"github.com/anynines/gitcredentials/git"
+)
+
+func main() {
+	logger := scribe.NewLogger(os.Stdout)
+	packit.Run(git.CleanupDetect(logger), git.CleanupBuild(logger))
+}
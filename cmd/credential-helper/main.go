@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/anynines/gitcredentials/git"
+)
+
+// main is run by GIT as credential helper with the file listing the minted
+// credentials and the operation as arguments
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintf(os.Stderr, "usage: %s <credentials file> <get|store|erase>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	err := git.RunCredentialHelper(os.Args[1], os.Args[2], os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", git.CredentialHelperName, git.Redact(err.Error()))
+		os.Exit(1)
+	}
+}
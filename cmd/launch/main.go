@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+
+	"github.com/anynines/gitcredentials/git"
+)
+
+// main is run as exec.d binary at container start, the lifecycle reads the
+// environment variables of the app process from file descriptor 3
+func main() {
+	logger := scribe.NewLogger(os.Stdout)
+
+	// the binary is copied to <layer>/exec.d, the credential helper is in
+	// <layer>/bin
+	executable, err := os.Executable()
+	if err != nil {
+		logger.Process("Failed to configure git: %s", err)
+		os.Exit(1)
+	}
+	binPath := filepath.Join(filepath.Dir(executable), "..", "bin")
+
+	err = git.Launch(logger, "", binPath, os.NewFile(3, "/dev/fd/3"))
+	if err != nil {
+		logger.Process("Failed to configure git: %s", git.Redact(err.Error()))
+		os.Exit(1)
+	}
+}
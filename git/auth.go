@@ -0,0 +1,112 @@
+package git
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// AuthBasic authenticates with username and password, the default
+	AuthBasic = "basic"
+
+	// AuthBearer authenticates with "Authorization: Bearer <token>", the
+	// password of the credential being the token
+	AuthBearer = "bearer"
+)
+
+// MinAuthTypeGitVersion is the first version of GIT whose credential protocol
+// and credential cache support the authtype and credential attributes. Older
+// versions send bearer tokens via http.<url>.extraHeader.
+var MinAuthTypeGitVersion = GitVersion{Major: 2, Minor: 46}
+
+var gitVersionPattern = regexp.MustCompile(`git version (\d+)\.(\d+)(?:\.(\d+))?`)
+
+// GitVersion represents the version of the installed GIT binary
+type GitVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseGitVersion parses the output of "git version"
+func ParseGitVersion(output string) (GitVersion, error) {
+	match := gitVersionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return GitVersion{}, fmt.Errorf("failed to parse git version %q", output)
+	}
+
+	var version GitVersion
+	version.Major, _ = strconv.Atoi(match[1])
+	version.Minor, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		version.Patch, _ = strconv.Atoi(match[3])
+	}
+
+	return version, nil
+}
+
+// AtLeast reports whether the version is equal to or newer than other
+func (v GitVersion) AtLeast(other GitVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Patch >= other.Patch
+}
+
+func (v GitVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// DetectGitVersion returns the version of the installed GIT binary
+func DetectGitVersion() (GitVersion, error) {
+	output, err := exec.Command("git", "version").Output()
+	if err != nil {
+		return GitVersion{}, err
+	}
+
+	return ParseGitVersion(string(output))
+}
+
+// IsBearer reports whether a credential authenticates with a bearer token
+func (c GitCredential) IsBearer() bool {
+	return c.Auth == AuthBearer
+}
+
+// HasBearerCredentials reports whether any credential authenticates with a
+// bearer token
+func (e BuildEnvironment) HasBearerCredentials() bool {
+	for _, credential := range e.BuildPackYML.Credentials {
+		if credential.IsBearer() {
+			return true
+		}
+	}
+	return false
+}
+
+// useExtraHeader reports whether a credential is sent via
+// http.<url>.extraHeader rather than the GIT credential cache
+func (e BuildEnvironment) useExtraHeader(credential GitCredential) bool {
+	return credential.IsBearer() && !e.GitVersion.AtLeast(MinAuthTypeGitVersion)
+}
+
+// validateAuth checks the auth mode of a credential
+func validateAuth(credential GitCredential) error {
+	switch credential.Auth {
+	case "", AuthBasic:
+		return nil
+	case AuthBearer:
+		if credential.Password == "" {
+			return fmt.Errorf("bearer credential for %s does not specify a token", credential.Host)
+		}
+		return nil
+	case AuthCookie:
+		return validateCookies(credential)
+	default:
+		return fmt.Errorf("unknown auth %q for %s, supported values are: %s, %s, %s", credential.Auth, credential.Host, AuthBasic, AuthBearer, AuthCookie)
+	}
+}
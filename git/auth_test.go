@@ -0,0 +1,102 @@
+package git_test
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testAuth(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	context("ParseGitVersion", func() {
+		it("parses the output of git version", func() {
+			for output, version := range map[string]git.GitVersion{
+				"git version 2.39.5\n":               {Major: 2, Minor: 39, Patch: 5},
+				"git version 2.46.0.windows.1":       {Major: 2, Minor: 46},
+				"git version 2.39.3 (Apple Git-146)": {Major: 2, Minor: 39, Patch: 3},
+				"git version 3.0":                    {Major: 3},
+			} {
+				parsed, err := git.ParseGitVersion(output)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(parsed).To(Equal(version))
+			}
+		})
+
+		it("fails for unexpected output", func() {
+			_, err := git.ParseGitVersion("hub version 2.14.2")
+			Expect(err).To(MatchError(`failed to parse git version "hub version 2.14.2"`))
+		})
+	})
+
+	context("AtLeast", func() {
+		it("compares versions", func() {
+			Expect(git.GitVersion{Major: 2, Minor: 46}.AtLeast(git.MinAuthTypeGitVersion)).To(BeTrue())
+			Expect(git.GitVersion{Major: 2, Minor: 47, Patch: 1}.AtLeast(git.MinAuthTypeGitVersion)).To(BeTrue())
+			Expect(git.GitVersion{Major: 3}.AtLeast(git.MinAuthTypeGitVersion)).To(BeTrue())
+			Expect(git.GitVersion{Major: 2, Minor: 45, Patch: 9}.AtLeast(git.MinAuthTypeGitVersion)).To(BeFalse())
+		})
+	})
+
+	context("Configure", func() {
+		var (
+			env    git.BuildEnvironment
+			output *bytes.Buffer
+		)
+
+		it.Before(func() {
+			output = &bytes.Buffer{}
+			env = git.BuildEnvironment{
+				Logger: scribe.NewLogger(output),
+				BuildPackYML: git.BuildPackYML{
+					Credentials: []git.GitCredential{
+						{Protocol: "https", Host: "bearer.example.com", Path: "/", Password: "s3cr3t-t0k3n", Auth: "bearer"},
+					},
+				},
+				GitVersion: git.GitVersion{Major: 2, Minor: 39},
+			}
+		})
+
+		it.After(func() {
+			_ = exec.Command("git", "config", "--global", "--unset-all", "http.https://bearer.example.com/.extraheader").Run()
+			_ = exec.Command("git", "config", "--global", "--unset-all", "url.https://bearer.example.com/.insteadof").Run()
+		})
+
+		it("sends bearer tokens via http.<url>.extraHeader on older git without logging them", func() {
+			Expect(env.HasBearerCredentials()).To(BeTrue())
+			Expect(env.Configure()).To(Succeed())
+
+			header, err := exec.Command("git", "config", "--global", "--get-all", "http.https://bearer.example.com/.extraheader").Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.TrimSpace(string(header))).To(Equal("Authorization: Bearer s3cr3t-t0k3n"))
+
+			Expect(output.String()).To(ContainSubstring("http.https://bearer.example.com/.extraHeader"))
+			Expect(output.String()).NotTo(ContainSubstring("s3cr3t-t0k3n"))
+		})
+
+		it("does not use http.<url>.extraHeader on newer git", func() {
+			env.GitVersion = git.GitVersion{Major: 2, Minor: 46}
+			Expect(env.Configure()).To(Succeed())
+
+			err := exec.Command("git", "config", "--global", "--get-all", "http.https://bearer.example.com/.extraheader").Run()
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("requires a token for bearer credentials", func() {
+			env.BuildPackYML.Credentials[0].Password = ""
+			Expect(env.Configure()).To(MatchError("bearer credential for bearer.example.com does not specify a token"))
+		})
+
+		it("fails for unknown auth modes", func() {
+			env.BuildPackYML.Credentials[0].Auth = "digest"
+			Expect(env.Configure()).To(MatchError(`unknown auth "digest" for bearer.example.com, supported values are: basic, bearer, cookie`))
+		})
+	})
+}
@@ -0,0 +1,32 @@
+package git
+
+import (
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
+)
+
+// CredentialsBindingType is the type of service bindings containing GIT
+// credentials
+const CredentialsBindingType = "git-credentials"
+
+// ResolveBindings returns all service bindings of the given type
+func ResolveBindings(bindingType string, platformPath string) ([]servicebindings.Binding, error) {
+	return servicebindings.NewResolver().Resolve(bindingType, "", platformPath)
+}
+
+// bindingEntry returns the trimmed contents of a binding entry and whether the
+// entry exists
+func bindingEntry(binding servicebindings.Binding, name string) (string, bool, error) {
+	entry, ok := binding.Entries[name]
+	if !ok {
+		return "", false, nil
+	}
+
+	value, err := entry.ReadString()
+	if err != nil {
+		return "", false, err
+	}
+
+	return strings.TrimSpace(value), true, nil
+}
@@ -9,6 +9,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
@@ -20,6 +23,19 @@ type BuildEnvironment struct {
 	Configuration Configuration
 	Context       packit.BuildContext
 	Logger        scribe.Logger
+
+	// GitVersion is the version of the installed GIT binary. It is only
+	// detected if a credential authenticates with a bearer token.
+	GitVersion GitVersion
+
+	// CacheTimeout is the number of seconds the GIT credential cache keeps
+	// credentials. Zero keeps the default of GIT, which suffices for a build.
+	CacheTimeout int
+
+	// CredentialHelper is the path of the credential helper binary which
+	// mints expiring passwords per request. Without it minted passwords are
+	// added to the GIT credential cache and fail once they expire.
+	CredentialHelper string
 }
 
 // Build executes the main functionality if this buildpack participates in the
@@ -36,12 +52,20 @@ func Build(logger scribe.Logger) packit.BuildFunc {
 		envCredentials := GitCredential{}
 		gitUserName, userNameExists := os.LookupEnv("GIT_CREDENTIALS_USERNAME")
 		gitPassword, passwordExists := os.LookupEnv("GIT_CREDENTIALS_PASSWORD")
-		if userNameExists && len(gitUserName) > 0 && passwordExists && len(gitPassword) > 0 {
-			logger.Process("Using environment variables GIT_CREDENTIALS_USERNAME and GIT_CREDENTIALS_PASSWORD")
+		gitProvider, providerExists := os.LookupEnv("GIT_CREDENTIALS_PROVIDER")
+		userNameDefined := userNameExists && len(gitUserName) > 0
+		providerDefined := providerExists && len(gitProvider) > 0
+		if (userNameDefined || providerDefined) && passwordExists && len(gitPassword) > 0 {
+			if userNameDefined {
+				logger.Process("Using environment variables GIT_CREDENTIALS_USERNAME and GIT_CREDENTIALS_PASSWORD")
+			} else {
+				logger.Process("Using environment variables GIT_CREDENTIALS_PROVIDER and GIT_CREDENTIALS_PASSWORD")
+			}
 
 			envCredentials = GitCredential{
 				Username: gitUserName,
 				Password: gitPassword,
+				Provider: gitProvider,
 			}
 
 			gitProtocol, protocolExists := os.LookupEnv("GIT_CREDENTIALS_PROTOCOL")
@@ -54,7 +78,7 @@ func Build(logger scribe.Logger) packit.BuildFunc {
 			gitHost, hostExists := os.LookupEnv("GIT_CREDENTIALS_HOST")
 			if hostExists && len(gitHost) > 0 {
 				envCredentials.Host = gitHost
-			} else {
+			} else if !providerDefined {
 				envCredentials.Host = configuration.DefaultHost
 			}
 
@@ -68,7 +92,7 @@ func Build(logger scribe.Logger) packit.BuildFunc {
 			gitURL, urlExists := os.LookupEnv("GIT_CREDENTIALS_URL")
 			if urlExists && len(gitURL) > 0 {
 				envCredentials.URL = gitURL
-			} else {
+			} else if !providerDefined {
 				envCredentials.URL = configuration.DefaultURL
 			}
 		}
@@ -78,32 +102,113 @@ func Build(logger scribe.Logger) packit.BuildFunc {
 			return packit.BuildResult{}, err
 		}
 
-		if len(envCredentials.Username) > 0 && len(envCredentials.Password) > 0 {
+		if len(envCredentials.Password) > 0 {
 			buildPackYML.Credentials = append(buildPackYML.Credentials, envCredentials)
 		}
 
-		if len(buildPackYML.Credentials) == 0 {
-			return packit.BuildResult{}, errors.New("No credentials were specified either in environment variables or in the buildpack.yml")
+		sourceCredentials, err := ReadCredentialSources(context.WorkingDir, context.Platform.Path, buildPackYML, logger)
+		if err != nil {
+			return packit.BuildResult{}, err
 		}
+		buildPackYML.Credentials = append(buildPackYML.Credentials, sourceCredentials...)
 
-		env := BuildEnvironment{
-			BuildPackYML:  buildPackYML,
-			Configuration: configuration,
-			Context:       context,
-			Logger:        logger,
+		requiredHosts, err := RequiredHosts(context.Plan)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		strict, err := StrictEnabled(buildPackYML)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		launchEnabled, err := LaunchEnabled(buildPackYML)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		var layers []packit.Layer
+		if launchEnabled {
+			launchLayer, err := context.Layers.Get(LaunchLayerName)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			launchLayer, err = NewLaunchLayer(launchLayer, context.CNBPath)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			layers = append(layers, launchLayer)
+
+			// credentials are resolved at runtime, the build itself does
+			// not necessarily require any
+			if len(buildPackYML.Credentials) == 0 {
+				logger.Process("No build time credentials were specified, configuring git at runtime only")
+
+				// hosts required by other buildpacks are fetched during
+				// the build, runtime credentials do not cover them
+				if len(requiredHosts) > 0 {
+					err = BuildEnvironment{BuildPackYML: buildPackYML, Logger: logger}.CheckRequiredHosts(requiredHosts, strict)
+					if err != nil {
+						return packit.BuildResult{}, err
+					}
+				}
+
+				// subsequent buildpacks learn that no host is covered
+				gitCredentialsLayer, err := context.Layers.Get("gitcredentials")
+				if err != nil {
+					return packit.BuildResult{}, err
+				}
+
+				gitCredentialsLayer.Build = true
+				gitCredentialsLayer.Cache = false
+				gitCredentialsLayer.Launch = false
+				gitCredentialsLayer.BuildEnv.Override(CredentialsHostsEnv, "")
+
+				return packit.BuildResult{
+					Layers: append(layers, gitCredentialsLayer),
+				}, nil
+			}
+		}
+
+		if len(buildPackYML.Credentials) == 0 {
+			return packit.BuildResult{}, errors.New("No credentials were specified either in environment variables or in the buildpack.yml")
 		}
 
-		err = env.Initialize()
+		buildPackYML.Credentials, err = ApplyProviderPresets(buildPackYML.Credentials)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
 
-		err = env.Configure()
+		buildPackYML.Credentials, err = MintTokens(buildPackYML.Credentials, logger)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
 
-		err = env.StoreCredentials()
+		env := BuildEnvironment{
+			BuildPackYML:     buildPackYML,
+			Configuration:    configuration,
+			Context:          context,
+			Logger:           logger,
+			CredentialHelper: CredentialHelperPath(filepath.Join(context.CNBPath, "bin")),
+		}
+
+		if env.HasBearerCredentials() {
+			env.GitVersion, err = DetectGitVersion()
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			logger.Process("Detected git version %s", env.GitVersion)
+		}
+
+		if len(requiredHosts) > 0 {
+			err = env.CheckRequiredHosts(requiredHosts, strict)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+		}
+
+		err = env.CheckManifests(strict)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
@@ -117,20 +222,201 @@ func Build(logger scribe.Logger) packit.BuildFunc {
 		gitCredentialsLayer.Cache = false
 		gitCredentialsLayer.Launch = false
 
+		configBefore, err := globalConfig()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		buildEnv, err := env.ConfigureGit(gitCredentialsLayer.Path)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		// the variables refer to secrets, they must only be visible to
+		// subsequent buildpacks and never end up in the app image
+		for name, value := range buildEnv {
+			gitCredentialsLayer.Build = true
+			gitCredentialsLayer.BuildEnv.Override(name, value)
+		}
+
+		goModulesEnabled, err := GoModulesEnabled(buildPackYML)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		if goModulesEnabled {
+			goModulesEnv, err := env.GoModulesEnv()
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			for name, value := range goModulesEnv {
+				gitCredentialsLayer.Build = true
+				gitCredentialsLayer.BuildEnv.Override(name, value)
+			}
+		}
+
+		// the covered hosts contain no secrets, they tell subsequent
+		// buildpacks which repositories they can fetch
+		gitCredentialsLayer.Build = true
+		gitCredentialsLayer.BuildEnv.Override(CredentialsHostsEnv, strings.Join(CoveredHosts(env.BuildPackYML.Credentials), ","))
+
+		layers = append(layers, gitCredentialsLayer)
+
+		if len(env.BuildPackYML.Prefetch) > 0 {
+			prefetchLayer, err := context.Layers.Get(PrefetchLayerName)
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			prefetchLayer, err = env.Prefetch(prefetchLayer, time.Now())
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			layers = append(layers, prefetchLayer)
+		}
+
+		// the cleanup buildpack removes everything added to the global GIT
+		// configuration, including the redirects to prefetched mirrors
+		err = env.writeCleanupState(gitCredentialsLayer.Path, configBefore)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
 		return packit.BuildResult{
-			Layers: []packit.Layer{
-				gitCredentialsLayer,
-			},
+			Layers: layers,
 		}, nil
 	}
 }
 
+// ConfigureGit configures GIT to authenticate with all credentials, writing
+// files such as SSH keys, cookies and certificates into the given layer
+// directory. It returns the environment variables which processes using GIT
+// have to set, e.g. SSH_AUTH_SOCK of the ssh-agent.
+func (e BuildEnvironment) ConfigureGit(layerPath string) (map[string]string, error) {
+	env := map[string]string{}
+
+	err := e.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.Configure()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(e.BuildPackYML.Mirrors) > 0 {
+		err = e.ConfigureMirrors()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.HasProxyConfig() {
+		err = e.ConfigureProxy()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = e.StoreCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	if e.HasMintedCredentials() {
+		if e.CredentialHelper != "" {
+			err = e.ConfigureCredentialHelper(layerPath)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			e.Logger.Subprocess("Warning: the credential helper is missing, minted passwords are cached and fail once they expire")
+		}
+	}
+
+	if e.HasSSHCredentials() {
+		err = e.ConfigureSSH(layerPath)
+		if err != nil {
+			return nil, err
+		}
+
+		// the ssh-agent keeps running until it is stopped by StopSSHAgent
+		if e.HasSSHPassphrases() {
+			env["SSH_AUTH_SOCK"] = filepath.Join(layerPath, SSHDirName, SSHAgentSocketName)
+		}
+	}
+
+	netrcEnabled, err := e.NetrcEnabled()
+	if err != nil {
+		return nil, err
+	}
+
+	if netrcEnabled {
+		netrcPath, err := e.WriteNetrc(layerPath)
+		if err != nil {
+			return nil, err
+		}
+		env["NETRC"] = netrcPath
+	}
+
+	if e.HasLFSConfig() {
+		skipSmudge, err := e.ConfigureLFS(layerPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if skipSmudge {
+			env["GIT_LFS_SKIP_SMUDGE"] = "1"
+		}
+	}
+
+	if e.HasCookieCredentials() {
+		err = e.ConfigureCookies(layerPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.HasTLSConfig() {
+		err = e.ConfigureTLS(layerPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return env, nil
+}
+
+// lookupEnvBool returns the boolean value of an environment variable. Unset
+// or empty variables are treated as false.
+func lookupEnvBool(name string) (bool, error) {
+	value, exists := os.LookupEnv(name)
+	if !exists || len(value) == 0 {
+		return false, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for %s: %q is not a boolean", name, value)
+	}
+
+	return enabled, nil
+}
+
 // RunGitCommand executes a GIT command with given arguments
 func (e BuildEnvironment) RunGitCommand(args []string) error {
+	return e.runGitCommand(args)
+}
+
+// runGitCommand executes a GIT command with given arguments and removes the
+// given secrets from its log output
+func (e BuildEnvironment) runGitCommand(args []string, secrets ...string) error {
 	cmd := exec.Command("git")
 	cmd.Args = args
 
-	e.Logger.Subprocess("Running command: " + cmd.String())
+	e.Logger.Subprocess("Running command: %s", Redact(cmd.String(), secrets...))
 
 	var stdOutBytes bytes.Buffer
 	cmd.Stdout = &stdOutBytes
@@ -142,7 +428,7 @@ func (e BuildEnvironment) RunGitCommand(args []string) error {
 	if err != nil {
 		e.Logger.Subprocess("Command failed")
 		if stdErrBytes.Len() > 0 {
-			e.Logger.Subprocess("Command stderr: %s", stdErrBytes.String())
+			e.Logger.Subprocess("Command stderr: %s", Redact(stdErrBytes.String(), secrets...))
 		}
 		e.Logger.Subprocess("Error status code: %s", err.Error())
 		e.Logger.Break()
@@ -151,7 +437,7 @@ func (e BuildEnvironment) RunGitCommand(args []string) error {
 
 	e.Logger.Subprocess("Command succeeded")
 	if stdOutBytes.Len() > 0 {
-		e.Logger.Subprocess("Command output: %s", stdOutBytes.String())
+		e.Logger.Subprocess("Command output: %s", Redact(stdOutBytes.String(), secrets...))
 	}
 	e.Logger.Break()
 
@@ -162,13 +448,19 @@ func (e BuildEnvironment) RunGitCommand(args []string) error {
 // memory exclusively
 func (e BuildEnvironment) Initialize() error {
 	e.Logger.Process("Initializing GIT credentials cache")
+
+	helper := "cache"
+	if e.CacheTimeout > 0 {
+		helper = fmt.Sprintf("cache --timeout=%d", e.CacheTimeout)
+	}
+
 	return e.RunGitCommand([]string{
 		"git",
 		"config",
 		"--replace-all",
 		"--global",
 		"credential.helper",
-		"cache",
+		helper,
 	})
 }
 
@@ -177,39 +469,94 @@ func (e BuildEnvironment) Initialize() error {
 func (e BuildEnvironment) Configure() error {
 	e.Logger.Process("Configuring git to use HTTPs for authentication")
 
-	for _, credential := range e.BuildPackYML.Credentials {
-		credentialURL := credential.Protocol + "://" + credential.Host
-		if credential.URL != "" {
-			credentialURL = credential.URL
-		}
+	// a URL prefix can only be rewritten to a single URL, mirrors take
+	// precedence, otherwise the first credential wins
+	mirrored := e.mirroredPrefixes()
+	rewritten := e.mirroredPrefixes()
 
-		if credential.Path != "" {
-			credentialURL += credential.Path
-		} else {
-			credentialURL += "/"
+	for _, credential := range e.BuildPackYML.Credentials {
+		if credential.IsSSH() {
+			continue
 		}
 
-		credentialContext := "credential." + credentialURL + ".username"
-		err := e.RunGitCommand([]string{
-			"git",
-			"config",
-			"--global",
-			credentialContext,
-			credential.Username,
-		})
+		err := validateAuth(credential)
 		if err != nil {
 			return err
 		}
 
-		err = e.RunGitCommand([]string{
-			"git",
-			"config",
-			"--global",
-			"url." + credentialURL + ".insteadOf",
-			"git@" + credential.Host + ":",
-		})
-		if err != nil {
-			return err
+		credentialURL := credential.configURL()
+
+		if credential.UseHTTPPath {
+			err = e.RunGitCommand([]string{
+				"git",
+				"config",
+				"--global",
+				"credential." + credential.Protocol + "://" + credential.Host + ".useHttpPath",
+				"true",
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if e.useExtraHeader(credential) {
+			// the header must never be logged
+			header := "Authorization: Bearer " + credential.Password
+			err = e.runGitCommand([]string{
+				"git",
+				"config",
+				"--global",
+				"--add",
+				"http." + credentialURL + ".extraHeader",
+				header,
+			}, header, credential.Password)
+			if err != nil {
+				return err
+			}
+		} else if !credential.IsBearer() && !credential.IsCookie() {
+			credentialContext := "credential." + credentialURL + ".username"
+			err = e.RunGitCommand([]string{
+				"git",
+				"config",
+				"--global",
+				credentialContext,
+				credential.Username,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if !mirrored["git@"+credential.Host+":"] {
+			err = e.RunGitCommand([]string{
+				"git",
+				"config",
+				"--global",
+				"url." + credentialURL + ".insteadOf",
+				"git@" + credential.Host + ":",
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, insteadOf := range credential.InsteadOf {
+			if rewritten[insteadOf] {
+				continue
+			}
+			rewritten[insteadOf] = true
+
+			err = e.RunGitCommand([]string{
+				"git",
+				"config",
+				"--global",
+				"--add",
+				"url." + credentialURL + ".insteadOf",
+				insteadOf,
+			})
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -220,7 +567,16 @@ func (e BuildEnvironment) Configure() error {
 func (e BuildEnvironment) StoreCredentials() error {
 	e.Logger.Process("Adding credentials to GIT credentials cache")
 
-	for _, credential := range e.BuildPackYML.Credentials {
+	credentials, err := e.storedCredentials()
+	if err != nil {
+		return err
+	}
+
+	for _, credential := range credentials {
+		if credential.IsSSH() || credential.IsCookie() || e.useExtraHeader(credential) || e.useCredentialHelper(credential) {
+			continue
+		}
+
 		cmd := exec.Command("git")
 		cmd.Args = []string{
 			"git",
@@ -248,11 +604,19 @@ func (e BuildEnvironment) StoreCredentials() error {
 		go func() {
 			defer stdin.Close()
 			bf := ""
+			if credential.IsBearer() {
+				bf += "capability[]=authtype\n"
+			}
 			bf += fmt.Sprintf("protocol=" + credential.Protocol + "\n")
 			bf += fmt.Sprintf("host=" + credential.Host + "\n")
 			bf += fmt.Sprintf("path=" + credential.Path + "\n")
-			bf += fmt.Sprintf("username=" + credential.Username + "\n")
-			bf += fmt.Sprintf("password=" + credential.Password + "\n")
+			if credential.IsBearer() {
+				bf += "authtype=Bearer\n"
+				bf += "credential=" + credential.Password + "\n"
+			} else {
+				bf += fmt.Sprintf("username=" + credential.Username + "\n")
+				bf += fmt.Sprintf("password=" + credential.Password + "\n")
+			}
 			if credential.URL != "" {
 				bf += fmt.Sprintf("url=" + credential.URL + "\n")
 			}
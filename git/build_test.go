@@ -1,16 +1,24 @@
 package git_test
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/anynines/gitcredentials/git"
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
 	"github.com/sclevine/spec"
+	yaml "gopkg.in/yaml.v2"
 
 	. "github.com/onsi/gomega"
 )
@@ -81,11 +89,11 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				{
 					Path:             "gitcredentials",
 					Name:             "gitcredentials",
-					Build:            false,
+					Build:            true,
 					Launch:           false,
 					Cache:            false,
 					SharedEnv:        packit.Environment{},
-					BuildEnv:         packit.Environment{},
+					BuildEnv:         packit.Environment{"GIT_CREDENTIALS_HOSTS.override": "github.com"},
 					LaunchEnv:        packit.Environment{},
 					ProcessLaunchEnv: map[string]packit.Environment{},
 					Metadata:         nil,
@@ -169,11 +177,11 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				{
 					Path:             "gitcredentials",
 					Name:             "gitcredentials",
-					Build:            false,
+					Build:            true,
 					Launch:           false,
 					Cache:            false,
 					SharedEnv:        packit.Environment{},
-					BuildEnv:         packit.Environment{},
+					BuildEnv:         packit.Environment{"GIT_CREDENTIALS_HOSTS.override": "newexample.com/testpath"},
 					LaunchEnv:        packit.Environment{},
 					ProcessLaunchEnv: map[string]packit.Environment{},
 					Metadata:         nil,
@@ -191,6 +199,191 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		unsetGitCredentials()
 	})
 
+	it("writes a .netrc into a build-only layer when enabled", func() {
+		someBuildPackTomlFile, err := ioutil.ReadFile(buildPackTomlPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = ioutil.WriteFile(filepath.Join(cnbDir, "buildpack.toml"), someBuildPackTomlFile, 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		layersDir, err := ioutil.TempDir("", "layers")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(layersDir)
+
+		os.Setenv("GIT_CREDENTIALS_USERNAME", "testuser")
+		os.Setenv("GIT_CREDENTIALS_PASSWORD", "testpass")
+		os.Setenv("GIT_CREDENTIALS_NETRC", "true")
+
+		result, err := build(packit.BuildContext{
+			WorkingDir: workingDir,
+			CNBPath:    cnbDir,
+			Layers:     packit.Layers{Path: layersDir},
+			BuildpackInfo: packit.BuildpackInfo{
+				Name:    "Some Buildpack",
+				Version: "some-version",
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		netrcPath := filepath.Join(layersDir, "gitcredentials", ".netrc")
+		Expect(result.Layers).To(HaveLen(1))
+		Expect(result.Layers[0].Build).To(BeTrue())
+		Expect(result.Layers[0].Launch).To(BeFalse())
+		Expect(result.Layers[0].Cache).To(BeFalse())
+		Expect(result.Layers[0].BuildEnv).To(Equal(packit.Environment{
+			"NETRC.override":                 netrcPath,
+			"GIT_CREDENTIALS_HOSTS.override": "github.com",
+		}))
+		Expect(result.Layers[0].LaunchEnv).To(BeEmpty())
+
+		content, err := ioutil.ReadFile(netrcPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("machine github.com login testuser password testpass\n"))
+
+		os.Unsetenv("GIT_CREDENTIALS_USERNAME")
+		os.Unsetenv("GIT_CREDENTIALS_PASSWORD")
+		os.Unsetenv("GIT_CREDENTIALS_NETRC")
+		unsetGitCredentials()
+	})
+
+	it("configures a GitHub App credential which only specifies the host", func() {
+		someBuildPackTomlFile, err := ioutil.ReadFile(buildPackTomlPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = ioutil.WriteFile(filepath.Join(cnbDir, "buildpack.toml"), someBuildPackTomlFile, 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token": "ghs_installation", "expires_at": "2030-01-01T00:00:00Z"}`))
+		}))
+		defer server.Close()
+
+		buildPackYML, err := yaml.Marshal(map[string]interface{}{
+			"gitcredentials": map[string]interface{}{
+				"credentials": []interface{}{
+					map[string]interface{}{
+						"host": "github.com",
+						"github_app": map[string]interface{}{
+							"app_id":          "123",
+							"installation_id": "456",
+							"private_key":     string(privateKeyPEM),
+							"api_url":         server.URL,
+						},
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(workingDir, "buildpack.yml"), buildPackYML, 0644)).To(Succeed())
+
+		_, err = build(packit.BuildContext{
+			WorkingDir: workingDir,
+			CNBPath:    cnbDir,
+			BuildpackInfo: packit.BuildpackInfo{
+				Name:    "Some Buildpack",
+				Version: "some-version",
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer unsetGitCredentials()
+
+		output, err := exec.Command("git", "config", "--global", "--get", "credential.https://github.com/.username").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(Equal("x-access-token\n"))
+
+		output, err = exec.Command("git", "config", "--global", "--list").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).NotTo(ContainSubstring(".://github.com"))
+
+		fill := exec.Command("git", "credential", "fill")
+		fill.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		fill.Stdin = strings.NewReader("protocol=https\nhost=github.com\npath=/acme/repo.git\n")
+		output, err = fill.Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(ContainSubstring("password=ghs_installation"))
+	})
+
+	it("contributes the launch layer and no covered hosts in launch mode without credentials", func() {
+		someBuildPackTomlFile, err := ioutil.ReadFile(buildPackTomlPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = ioutil.WriteFile(filepath.Join(cnbDir, "buildpack.toml"), someBuildPackTomlFile, 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		layersDir, err := ioutil.TempDir("", "layers")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(layersDir)
+
+		os.Setenv("GIT_CREDENTIALS_LAUNCH", "true")
+		defer os.Unsetenv("GIT_CREDENTIALS_LAUNCH")
+
+		result, err := build(packit.BuildContext{
+			WorkingDir: workingDir,
+			CNBPath:    cnbDir,
+			Layers:     packit.Layers{Path: layersDir},
+			BuildpackInfo: packit.BuildpackInfo{
+				Name:    "Some Buildpack",
+				Version: "some-version",
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Layers).To(HaveLen(2))
+		Expect(result.Layers[0].Name).To(Equal(git.LaunchLayerName))
+		Expect(result.Layers[0].Launch).To(BeTrue())
+		Expect(result.Layers[0].Build).To(BeFalse())
+		Expect(result.Layers[0].ExecD).To(Equal([]string{filepath.Join(cnbDir, "bin", "launch")}))
+
+		Expect(result.Layers[1].Name).To(Equal("gitcredentials"))
+		Expect(result.Layers[1].Build).To(BeTrue())
+		Expect(result.Layers[1].Launch).To(BeFalse())
+		Expect(result.Layers[1].Cache).To(BeFalse())
+		Expect(result.Layers[1].BuildEnv).To(Equal(packit.Environment{"GIT_CREDENTIALS_HOSTS.override": ""}))
+	})
+
+	it("checks required hosts in launch mode without credentials", func() {
+		someBuildPackTomlFile, err := ioutil.ReadFile(buildPackTomlPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = ioutil.WriteFile(filepath.Join(cnbDir, "buildpack.toml"), someBuildPackTomlFile, 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		layersDir, err := ioutil.TempDir("", "layers")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(layersDir)
+
+		os.Setenv("GIT_CREDENTIALS_LAUNCH", "true")
+		os.Setenv("GIT_CREDENTIALS_STRICT", "true")
+		defer os.Unsetenv("GIT_CREDENTIALS_LAUNCH")
+		defer os.Unsetenv("GIT_CREDENTIALS_STRICT")
+
+		_, err = build(packit.BuildContext{
+			WorkingDir: workingDir,
+			CNBPath:    cnbDir,
+			Layers:     packit.Layers{Path: layersDir},
+			BuildpackInfo: packit.BuildpackInfo{
+				Name:    "Some Buildpack",
+				Version: "some-version",
+			},
+			Plan: packit.BuildpackPlan{
+				Entries: []packit.BuildpackPlanEntry{
+					{
+						Name: "gitcredentials",
+						Metadata: map[string]interface{}{
+							"hosts": []interface{}{"github.com/acme"},
+						},
+					},
+				},
+			},
+		})
+		Expect(err).To(MatchError("required hosts are not covered by any credential: github.com/acme"))
+	})
+
 	it("git binary is not installed", func() {
 		someBuildPackTomlFile, err := ioutil.ReadFile(buildPackTomlPath)
 		Expect(err).NotTo(HaveOccurred())
@@ -264,6 +457,7 @@ func unsetGitCredentials() {
 		{"git", "config", "--global", "--unset", "credential.https://newexample.com/testpath/.username"},
 		{"git", "config", "--global", "--unset", "url.https://github.com/.insteadof"},
 		{"git", "config", "--global", "--unset", "url.https://newexample.com/testpath/.insteadof"},
+		{"git", "config", "--global", "--remove-section", "gitcredentials"},
 	}
 
 	gitbin, err := exec.LookPath("git")
@@ -9,17 +9,115 @@ import (
 // GitCredential represents GIT credentials to be stored in the GIT credentials
 // cache
 type GitCredential struct {
-	Protocol string `yaml:"protocol"`
-	Host     string `yaml:"host"`
-	Path     string `yaml:"path"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	URL      string `yaml:"url"`
+	Protocol string `yaml:"protocol" json:"protocol"`
+	Host     string `yaml:"host" json:"host"`
+	Path     string `yaml:"path" json:"path"`
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+	URL      string `yaml:"url" json:"url"`
+
+	// Provider fills in host, username and URL rewrites from the preset of a
+	// Git hosting provider, see ProviderPresets
+	Provider string `yaml:"provider" json:"provider"`
+
+	// Auth selects how the password is sent, either as "basic" (default) or
+	// as "bearer" token. With "cookie" the cookies are sent instead.
+	Auth string `yaml:"auth" json:"auth"`
+
+	// Cookies are sent with "cookie" auth, either in Netscape cookie file
+	// format or as "name=value" lines. Alternatively, CookiesBinding names a
+	// service binding of type git-cookies containing them.
+	Cookies        string `yaml:"cookies" json:"cookies"`
+	CookiesBinding string `yaml:"cookies_binding" json:"cookies_binding"`
+
+	// InsteadOf lists additional URL prefixes which are rewritten to the URL
+	// of the credential
+	InsteadOf []string `yaml:"instead_of" json:"instead_of"`
+
+	// TLS specifies a CA bundle and a client certificate for HTTPS
+	TLS *TLSConfig `yaml:"tls" json:"tls"`
+
+	// Proxy is the HTTP proxy used to reach the URL of the credential
+	Proxy *ProxyConfig `yaml:"proxy" json:"proxy"`
+
+	// LFS specifies the Git LFS endpoint and settings
+	LFS *LFSConfig `yaml:"lfs" json:"lfs"`
+
+	// SSHKey is a private key used to authenticate via SSH. Credentials with
+	// an SSH key are not added to the GIT credential cache.
+	SSHKey     string `yaml:"ssh_key" json:"ssh_key"`
+	KnownHosts string `yaml:"known_hosts" json:"known_hosts"`
+
+	// Passphrase decrypts an encrypted SSH key, alternatively PassphraseEnv
+	// names an environment variable containing it. Encrypted keys are loaded
+	// into a dedicated ssh-agent.
+	Passphrase    string `yaml:"passphrase" json:"passphrase"`
+	PassphraseEnv string `yaml:"passphrase_env" json:"passphrase_env"`
+
+	// UseHTTPPath makes GIT pass the path of a repository to the credential
+	// cache, so that different credentials can be used per repository
+	UseHTTPPath bool `yaml:"use_http_path" json:"use_http_path"`
+
+	// GitHubApp and OIDCExchange mint the password of a credential at build
+	// time, CodeCommit expands to one signed credential per repository
+	GitHubApp    *GitHubApp    `yaml:"github_app" json:"github_app"`
+	OIDCExchange *OIDCExchange `yaml:"oidc_exchange" json:"oidc_exchange"`
+	CodeCommit   *CodeCommit   `yaml:"codecommit" json:"codecommit"`
+}
+
+// IsSSH reports whether a credential is used to authenticate via SSH
+func (c GitCredential) IsSSH() bool {
+	return len(c.SSHKey) > 0
+}
+
+// WithDefaults returns the credential with its protocol defaulting to "https"
+// (or "ssh" for SSH credentials) and its path defaulting to "/"
+func (c GitCredential) WithDefaults() GitCredential {
+	if c.Protocol == "" {
+		c.Protocol = "https"
+		if c.IsSSH() {
+			c.Protocol = "ssh"
+		}
+	}
+
+	if c.Path == "" && !c.IsSSH() {
+		c.Path = "/"
+	}
+
+	return c
+}
+
+// configURL returns the URL used to scope GIT configuration to a credential
+func (c GitCredential) configURL() string {
+	credentialURL := c.Protocol + "://" + c.Host
+	if c.URL != "" {
+		credentialURL = c.URL
+	}
+
+	if c.Path != "" {
+		credentialURL += c.Path
+	} else {
+		credentialURL += "/"
+	}
+
+	return credentialURL
 }
 
 // BuildPackYML represents the buildpack.yml file provided by a user / an app
 type BuildPackYML struct {
-	Credentials []GitCredential `yaml:"credentials,omitempty"`
+	Credentials     []GitCredential      `yaml:"credentials,omitempty"`
+	CredentialsFile string               `yaml:"credentials_file,omitempty"`
+	Netrc           bool                 `yaml:"netrc,omitempty"`
+	VCAPLabel       string               `yaml:"vcap_label,omitempty"`
+	Vault           VaultConfig          `yaml:"vault,omitempty"`
+	Providers       []CredentialProvider `yaml:"providers,omitempty"`
+	Proxy           ProxyConfig          `yaml:"proxy,omitempty"`
+	Mirrors         []Mirror             `yaml:"mirrors,omitempty"`
+	Prefetch        []string             `yaml:"prefetch,omitempty"`
+	Launch          bool                 `yaml:"launch,omitempty"`
+	Strict          bool                 `yaml:"strict,omitempty"`
+	GoModules       bool                 `yaml:"go_modules,omitempty"`
+	GoModulesHosts  bool                 `yaml:"go_modules_hosts,omitempty"`
 }
 
 // BuildpackYMLParse parses the buildpack.yml file
@@ -41,9 +139,5 @@ func BuildpackYMLParse(path string) (BuildPackYML, error) {
 		}
 	}
 
-	if len(buildpack.Gitcredentials.Credentials) == 0 {
-		return BuildPackYML{}, nil
-	}
-
 	return buildpack.Gitcredentials, nil
 }
@@ -0,0 +1,388 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+const (
+	// CleanupSection is the section of the global GIT configuration which
+	// records what the build added to the global GIT configuration and the
+	// credential cache, so that the cleanup buildpack can remove it. It
+	// contains no secrets: configuration values are only recorded as SHA-256
+	// hashes and credentials without their passwords.
+	CleanupSection = "gitcredentials"
+)
+
+// configEntry is an entry of the global GIT configuration
+type configEntry struct {
+	key   string
+	value string
+}
+
+// fingerprint identifies an entry without revealing its value
+func (c configEntry) fingerprint() string {
+	sum := sha256.Sum256([]byte(c.value))
+	return c.key + " " + hex.EncodeToString(sum[:])
+}
+
+// secretConfigVariables are the variables of the GIT configuration whose
+// values may carry secrets: authorization headers, proxy credentials and the
+// paths of cookie files
+var secretConfigVariables = []string{"extraheader", "proxy", "cookiefile"}
+
+// secret reports whether the value of an entry may carry a secret and must
+// not be logged
+func (c configEntry) secret() bool {
+	key := strings.ToLower(c.key)
+	for _, variable := range secretConfigVariables {
+		if strings.HasSuffix(key, "."+variable) {
+			return true
+		}
+	}
+	return false
+}
+
+// globalConfig returns all entries of the global GIT configuration
+func globalConfig() ([]configEntry, error) {
+	output, err := exec.Command("git", "config", "--global", "--null", "--list").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// there is no global configuration yet
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []configEntry
+	for _, item := range strings.Split(string(output), "\x00") {
+		if item == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(item, "\n")
+		entries = append(entries, configEntry{key: key, value: value})
+	}
+
+	return entries, nil
+}
+
+// writeCleanupState records the entries added to the global GIT configuration
+// since the snapshot before, the credentials added to the credential cache and
+// the given layer directory in the section gitcredentials of the global GIT
+// configuration
+func (e BuildEnvironment) writeCleanupState(layerPath string, before []configEntry) error {
+	e.Logger.Process("Recording configuration for the cleanup buildpack")
+
+	after, err := globalConfig()
+	if err != nil {
+		return err
+	}
+
+	existing := map[configEntry]int{}
+	for _, entry := range before {
+		existing[entry]++
+	}
+
+	state := []string{CleanupSection + ".layer", layerPath}
+	for _, entry := range after {
+		if existing[entry] > 0 {
+			existing[entry]--
+			continue
+		}
+		state = append(state, CleanupSection+".config", entry.fingerprint())
+	}
+
+	credentials, err := e.storedCredentials()
+	if err != nil {
+		return err
+	}
+
+	for _, credential := range credentials {
+		if credential.IsSSH() || credential.IsCookie() || e.useExtraHeader(credential) || e.useCredentialHelper(credential) {
+			continue
+		}
+
+		fields := url.Values{}
+		fields.Set("protocol", credential.Protocol)
+		fields.Set("host", credential.Host)
+		fields.Set("path", credential.Path)
+		if credential.Username != "" {
+			fields.Set("username", credential.Username)
+		}
+		if credential.URL != "" {
+			fields.Set("url", credential.URL)
+		}
+		state = append(state, CleanupSection+".credential", fields.Encode())
+	}
+
+	for i := 0; i < len(state); i += 2 {
+		err = e.RunGitCommand([]string{
+			"git",
+			"config",
+			"--global",
+			"--add",
+			state[i],
+			state[i+1],
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cleanupState returns the values of a key of the section gitcredentials
+func cleanupState(name string) ([]string, error) {
+	output, err := exec.Command("git", "config", "--global", "--null", "--get-all", CleanupSection+"."+name).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var values []string
+	for _, value := range strings.Split(string(output), "\x00") {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values, nil
+}
+
+// CleanupDetect links the cleanup buildpack to this buildpack: it requires
+// gitcredentials, so it only participates if this buildpack does
+func CleanupDetect(logger scribe.Logger) packit.DetectFunc {
+	return func(context packit.DetectContext) (packit.DetectResult, error) {
+		logger.Title("%s %s", context.BuildpackInfo.Name, context.BuildpackInfo.Version)
+
+		return packit.DetectResult{
+			Plan: packit.BuildPlan{
+				Requires: []packit.BuildPlanRequirement{
+					{
+						Name: "gitcredentials",
+					},
+				},
+			},
+		}, nil
+	}
+}
+
+// CleanupBuild tears down the credentials after the buildpacks which depend on
+// them ran
+func CleanupBuild(logger scribe.Logger) packit.BuildFunc {
+	return func(context packit.BuildContext) (packit.BuildResult, error) {
+		logger.Title("%s %s", context.BuildpackInfo.Name, context.BuildpackInfo.Version)
+
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		err = Cleanup(logger, home)
+		if err != nil {
+			return packit.BuildResult{}, err
+		}
+
+		return packit.BuildResult{}, nil
+	}
+}
+
+// Cleanup erases the credentials from the GIT credential cache, stops the
+// credential cache daemon and the ssh-agent, removes the entries the build
+// added to the global GIT configuration as well as the files containing
+// credentials, and verifies that no credential material remains in home
+func Cleanup(logger scribe.Logger, home string) error {
+	env := BuildEnvironment{Logger: logger}
+
+	layerPaths, err := cleanupState("layer")
+	if err != nil {
+		return err
+	}
+
+	if len(layerPaths) == 0 {
+		logger.Process("No credentials were configured, nothing to clean up")
+		return VerifyCleanup(home)
+	}
+
+	credentials, err := cleanupState("credential")
+	if err != nil {
+		return err
+	}
+
+	logger.Process("Erasing credentials from GIT credentials cache")
+	for _, credential := range credentials {
+		err = env.rejectCredential(credential)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Process("Stopping GIT credentials cache")
+	err = env.RunGitCommand([]string{"git", "credential-cache", "exit"})
+	if err != nil {
+		return err
+	}
+
+	fingerprints, err := cleanupState("config")
+	if err != nil {
+		return err
+	}
+
+	logger.Process("Removing GIT configuration")
+	err = env.removeConfig(fingerprints)
+	if err != nil {
+		return err
+	}
+
+	err = env.RunGitCommand([]string{"git", "config", "--global", "--remove-section", CleanupSection})
+	if err != nil {
+		return err
+	}
+
+	for _, layerPath := range layerPaths {
+		err = StopSSHAgent(layerPath)
+		if err != nil {
+			return err
+		}
+
+		logger.Process("Removing credential files from %s", layerPath)
+		for _, name := range []string{SSHDirName, NetrcFileName, CookiesDirName, TLSDirName, LFSDirName, MintedCredentialsFileName} {
+			err = os.RemoveAll(filepath.Join(layerPath, name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return VerifyCleanup(home)
+}
+
+// rejectCredential erases a credential from the GIT credential cache. The
+// cache matches on the recorded fields, so the password is not required.
+func (e BuildEnvironment) rejectCredential(credential string) error {
+	fields, err := url.ParseQuery(credential)
+	if err != nil {
+		return fmt.Errorf("invalid entry %s.credential %q: %w", CleanupSection, credential, err)
+	}
+
+	e.Logger.Subprocess("Erasing credential for %s://%s%s", fields.Get("protocol"), fields.Get("host"), fields.Get("path"))
+
+	input := ""
+	for _, name := range []string{"protocol", "host", "path", "username", "url"} {
+		if fields.Has(name) {
+			input += name + "=" + fields.Get(name) + "\n"
+		}
+	}
+
+	cmd := exec.Command("git", "credential", "reject")
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to erase credential for %s: %w: %s", fields.Get("host"), err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// removeConfig removes the entries with the given fingerprints from the
+// global GIT configuration. Entries the user changed in the meantime no
+// longer match and are kept.
+func (e BuildEnvironment) removeConfig(fingerprints []string) error {
+	recorded := map[string]bool{}
+	for _, fingerprint := range fingerprints {
+		recorded[fingerprint] = true
+	}
+
+	current, err := globalConfig()
+	if err != nil {
+		return err
+	}
+
+	removed := map[configEntry]bool{}
+	for _, entry := range current {
+		if !recorded[entry.fingerprint()] || removed[entry] {
+			continue
+		}
+		removed[entry] = true
+
+		var secrets []string
+		if entry.secret() {
+			secrets = []string{entry.value, regexp.QuoteMeta(entry.value)}
+		}
+
+		err = e.runGitCommand([]string{
+			"git",
+			"config",
+			"--global",
+			"--unset-all",
+			entry.key,
+			"^" + regexp.QuoteMeta(entry.value) + "$",
+		}, secrets...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// VerifyCleanup checks that no credential material remains in home: neither
+// a socket of the GIT credential cache daemon nor files storing credentials
+// in plain text
+func VerifyCleanup(home string) error {
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome == "" {
+		cacheHome = filepath.Join(home, ".cache")
+	}
+
+	sockets := []string{
+		filepath.Join(home, ".git-credential-cache", "socket"),
+		filepath.Join(cacheHome, "git", "credential", "socket"),
+	}
+
+	// the daemon removes its socket only after answering "exit"
+	deadline := time.Now().Add(2 * time.Second)
+	var leftovers []string
+	for {
+		leftovers = nil
+		for _, path := range sockets {
+			if _, err := os.Lstat(path); err == nil {
+				leftovers = append(leftovers, path)
+			}
+		}
+		if len(leftovers) == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for _, name := range []string{".git-credentials", filepath.Join(".config", "git", "credentials"), NetrcFileName} {
+		path := filepath.Join(home, name)
+		if _, err := os.Lstat(path); err == nil {
+			leftovers = append(leftovers, path)
+		}
+	}
+
+	if len(leftovers) > 0 {
+		return fmt.Errorf("credential material remains in %s: %s", home, strings.Join(leftovers, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package git
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// CodeCommitBindingType is the type of service bindings containing AWS
+// credentials for CodeCommit
+const CodeCommitBindingType = "codecommit"
+
+// CodeCommit configures credentials for AWS CodeCommit repositories. The
+// password of each repository is a SigV4 signature which CodeCommit only
+// accepts for 15 minutes, so like the credential helper of the AWS CLI the
+// credential helper of this buildpack signs it for each request of GIT. The
+// AWS credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN unless given otherwise.
+type CodeCommit struct {
+	Region       string   `yaml:"region" json:"region"`
+	Repositories []string `yaml:"repositories" json:"repositories"`
+
+	AccessKeyID     string `yaml:"-" json:"access_key_id"`
+	SecretAccessKey string `yaml:"-" json:"secret_access_key"`
+	SessionToken    string `yaml:"-" json:"session_token"`
+}
+
+// CodeCommitHost returns the GIT host of CodeCommit in the given region
+func CodeCommitHost(region string) string {
+	return "git-codecommit." + region + ".amazonaws.com"
+}
+
+// readCodeCommitSources returns CodeCommit credentials configured by service
+// bindings of type "codecommit" (entries "region", "repositories",
+// "access-key-id", "secret-access-key" and optionally "session-token") and by
+// the environment variable GIT_CREDENTIALS_CODECOMMIT_REPOSITORIES together
+// with GIT_CREDENTIALS_CODECOMMIT_REGION (or AWS_REGION)
+func readCodeCommitSources(platformPath string) ([]GitCredential, error) {
+	credentials, err := readCodeCommitBindings(platformPath)
+	if err != nil {
+		return nil, err
+	}
+
+	gitRepositories, repositoriesExists := os.LookupEnv("GIT_CREDENTIALS_CODECOMMIT_REPOSITORIES")
+	if repositoriesExists && len(gitRepositories) > 0 {
+		region := os.Getenv("GIT_CREDENTIALS_CODECOMMIT_REGION")
+		if region == "" {
+			region = os.Getenv("AWS_REGION")
+		}
+
+		credentials = append(credentials, GitCredential{
+			CodeCommit: &CodeCommit{
+				Region:       region,
+				Repositories: splitList(gitRepositories),
+			},
+		})
+	}
+
+	return credentials, nil
+}
+
+// readCodeCommitBindings returns CodeCommit credentials configured by service
+// bindings of type "codecommit"
+func readCodeCommitBindings(platformPath string) ([]GitCredential, error) {
+	var credentials []GitCredential
+
+	bindings, err := ResolveBindings(CodeCommitBindingType, platformPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, binding := range bindings {
+		entries := map[string]string{}
+		for _, name := range []string{"region", "repositories", "access-key-id", "secret-access-key", "session-token"} {
+			value, _, err := bindingEntry(binding, name)
+			if err != nil {
+				return nil, err
+			}
+			entries[name] = value
+		}
+
+		codeCommit := CodeCommit{
+			Region:          entries["region"],
+			Repositories:    splitList(entries["repositories"]),
+			AccessKeyID:     entries["access-key-id"],
+			SecretAccessKey: entries["secret-access-key"],
+			SessionToken:    entries["session-token"],
+		}
+		if codeCommit.AccessKeyID == "" || codeCommit.SecretAccessKey == "" {
+			return nil, fmt.Errorf("invalid service binding %s: CodeCommit requires an access key ID and a secret access key", binding.Name)
+		}
+
+		credentials = append(credentials, GitCredential{CodeCommit: &codeCommit})
+	}
+
+	return credentials, nil
+}
+
+// CodeCommitCredentials returns one credential per repository, signed at the
+// given time. Each credential keeps the CodeCommit configuration of its
+// repository, including the AWS credentials, so that it can be signed again
+// once the signature expired.
+func CodeCommitCredentials(codeCommit CodeCommit, now time.Time) ([]GitCredential, error) {
+	if codeCommit.Region == "" {
+		return nil, errors.New("CodeCommit requires a region")
+	}
+
+	if len(codeCommit.Repositories) == 0 {
+		return nil, errors.New("CodeCommit requires at least one repository")
+	}
+
+	if codeCommit.AccessKeyID == "" && codeCommit.SecretAccessKey == "" {
+		codeCommit.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		codeCommit.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		codeCommit.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	if codeCommit.AccessKeyID == "" || codeCommit.SecretAccessKey == "" {
+		return nil, errors.New("CodeCommit requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	host := CodeCommitHost(codeCommit.Region)
+	username := codeCommit.AccessKeyID
+	if codeCommit.SessionToken != "" {
+		username += "%" + codeCommit.SessionToken
+	}
+
+	var credentials []GitCredential
+	for _, repository := range codeCommit.Repositories {
+		path := "/v1/repos/" + strings.Trim(repository, "/")
+
+		repositoryCodeCommit := codeCommit
+		repositoryCodeCommit.Repositories = []string{repository}
+
+		credentials = append(credentials, GitCredential{
+			Protocol:    "https",
+			Host:        host,
+			Path:        path,
+			Username:    username,
+			Password:    CodeCommitPassword(codeCommit.SecretAccessKey, codeCommit.Region, host, path, now),
+			UseHTTPPath: true,
+			CodeCommit:  &repositoryCodeCommit,
+		})
+	}
+
+	return credentials, nil
+}
+
+// CodeCommitPassword computes the password CodeCommit expects for a
+// repository: the signing time followed by a SigV4 signature of a "GIT"
+// request for the repository path
+func CodeCommitPassword(secretAccessKey string, region string, host string, path string, now time.Time) string {
+	now = now.UTC()
+	timestamp := now.Format("20060102T150405")
+	date := now.Format("20060102")
+
+	canonicalRequest := "GIT\n" + path + "\n\nhost:" + host + "\n\nhost\n"
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + region + "/codecommit/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "codecommit")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	return timestamp + "Z" + hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data using the given key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,167 @@
+package git_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testCodeCommit(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	const secretAccessKey = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+
+	it.After(func() {
+		os.Unsetenv("AWS_ACCESS_KEY_ID")
+		os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+		os.Unsetenv("AWS_SESSION_TOKEN")
+		os.Unsetenv("AWS_REGION")
+		os.Unsetenv("GIT_CREDENTIALS_CODECOMMIT_REPOSITORIES")
+	})
+
+	context("CodeCommitPassword", func() {
+		it("computes known signatures", func() {
+			Expect(git.CodeCommitPassword(
+				secretAccessKey,
+				"us-east-1",
+				"git-codecommit.us-east-1.amazonaws.com",
+				"/v1/repos/MyDemoRepo",
+				time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC),
+			)).To(Equal("20150830T123600Z71a5887e4f38a6f59e48648fbecae25b7ca0668a8a7541bbfe22c8209ba6d04e"))
+
+			Expect(git.CodeCommitPassword(
+				secretAccessKey,
+				"eu-central-1",
+				"git-codecommit.eu-central-1.amazonaws.com",
+				"/v1/repos/other",
+				time.Date(2024, 3, 1, 0, 59, 59, 0, time.FixedZone("CET", 3600)),
+			)).To(Equal("20240229T235959Z4b51de04993e43d83b9cb3fa33cab0865afbb7bb999e719f24bbdac301db4662"))
+		})
+	})
+
+	context("CodeCommitCredentials", func() {
+		it("returns one credential per repository using the AWS environment variables", func() {
+			os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+			os.Setenv("AWS_SECRET_ACCESS_KEY", secretAccessKey)
+			os.Setenv("AWS_SESSION_TOKEN", "session")
+
+			credentials, err := git.CodeCommitCredentials(git.CodeCommit{
+				Region:       "us-east-1",
+				Repositories: []string{"MyDemoRepo", "/other/"},
+			}, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(HaveLen(2))
+			Expect(credentials[0]).To(Equal(git.GitCredential{
+				Protocol:    "https",
+				Host:        "git-codecommit.us-east-1.amazonaws.com",
+				Path:        "/v1/repos/MyDemoRepo",
+				Username:    "AKIDEXAMPLE%session",
+				Password:    "20150830T123600Z71a5887e4f38a6f59e48648fbecae25b7ca0668a8a7541bbfe22c8209ba6d04e",
+				UseHTTPPath: true,
+				CodeCommit: &git.CodeCommit{
+					Region:          "us-east-1",
+					Repositories:    []string{"MyDemoRepo"},
+					AccessKeyID:     "AKIDEXAMPLE",
+					SecretAccessKey: secretAccessKey,
+					SessionToken:    "session",
+				},
+			}))
+			Expect(credentials[1].Path).To(Equal("/v1/repos/other"))
+		})
+
+		it("prefers explicitly given AWS credentials", func() {
+			os.Setenv("AWS_ACCESS_KEY_ID", "ignored")
+			os.Setenv("AWS_SECRET_ACCESS_KEY", "ignored")
+
+			credentials, err := git.CodeCommitCredentials(git.CodeCommit{
+				Region:          "us-east-1",
+				Repositories:    []string{"MyDemoRepo"},
+				AccessKeyID:     "AKIDEXAMPLE",
+				SecretAccessKey: secretAccessKey,
+			}, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials[0].Username).To(Equal("AKIDEXAMPLE"))
+			Expect(credentials[0].Password).To(HaveSuffix("71a5887e4f38a6f59e48648fbecae25b7ca0668a8a7541bbfe22c8209ba6d04e"))
+		})
+
+		it("requires a region, repositories and AWS credentials", func() {
+			_, err := git.CodeCommitCredentials(git.CodeCommit{Repositories: []string{"repo"}}, time.Now())
+			Expect(err).To(MatchError("CodeCommit requires a region"))
+
+			_, err = git.CodeCommitCredentials(git.CodeCommit{Region: "us-east-1"}, time.Now())
+			Expect(err).To(MatchError("CodeCommit requires at least one repository"))
+
+			_, err = git.CodeCommitCredentials(git.CodeCommit{Region: "us-east-1", Repositories: []string{"repo"}}, time.Now())
+			Expect(err).To(MatchError("CodeCommit requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY"))
+		})
+	})
+
+	context("MintTokens", func() {
+		it("expands CodeCommit credentials", func() {
+			os.Setenv("AWS_REGION", "eu-west-1")
+			os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+			os.Setenv("AWS_SECRET_ACCESS_KEY", secretAccessKey)
+			os.Setenv("GIT_CREDENTIALS_CODECOMMIT_REPOSITORIES", "repo-a,repo-b")
+
+			logger := scribe.NewLogger(ioutil.Discard)
+			credentials, err := git.ReadCredentialSources("", "", git.BuildPackYML{}, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(Equal([]git.GitCredential{
+				{CodeCommit: &git.CodeCommit{Region: "eu-west-1", Repositories: []string{"repo-a", "repo-b"}}},
+			}))
+
+			credentials, err = git.MintTokens(credentials, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(HaveLen(2))
+			Expect(credentials[0].Host).To(Equal("git-codecommit.eu-west-1.amazonaws.com"))
+			Expect(credentials[1].Path).To(Equal("/v1/repos/repo-b"))
+		})
+	})
+
+	context("RunCredentialHelper", func() {
+		it("signs the password at the time of the request", func() {
+			credentials, err := git.CodeCommitCredentials(git.CodeCommit{
+				Region:          "us-east-1",
+				Repositories:    []string{"repo-a", "repo-b"},
+				AccessKeyID:     "AKIDEXAMPLE",
+				SecretAccessKey: secretAccessKey,
+			}, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+			Expect(err).NotTo(HaveOccurred())
+
+			dir, err := ioutil.TempDir("", "codecommit")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			content, err := json.Marshal(credentials)
+			Expect(err).NotTo(HaveOccurred())
+			credentialsPath := filepath.Join(dir, git.MintedCredentialsFileName)
+			Expect(ioutil.WriteFile(credentialsPath, content, 0600)).To(Succeed())
+
+			before := time.Now().UTC().Truncate(time.Second)
+			var output bytes.Buffer
+			err = git.RunCredentialHelper(credentialsPath, "get", strings.NewReader("protocol=https\nhost=git-codecommit.us-east-1.amazonaws.com\npath=v1/repos/repo-b\n\n"), &output)
+			Expect(err).NotTo(HaveOccurred())
+
+			fields := strings.Split(strings.TrimSpace(output.String()), "\n")
+			Expect(fields).To(HaveLen(2))
+			Expect(fields[0]).To(Equal("username=AKIDEXAMPLE"))
+
+			password := strings.TrimPrefix(fields[1], "password=")
+			signedAt, err := time.Parse("20060102T150405Z", password[:16])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(signedAt).To(BeTemporally(">=", before))
+			Expect(password).To(Equal(git.CodeCommitPassword(secretAccessKey, "us-east-1", "git-codecommit.us-east-1.amazonaws.com", "/v1/repos/repo-b", signedAt)))
+		})
+	})
+}
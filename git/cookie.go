@@ -0,0 +1,172 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// AuthCookie authenticates with cookies, e.g. for Gerrit
+	AuthCookie = "cookie"
+
+	// CookiesDirName is the name of the directory within the gitcredentials
+	// layer containing cookie files
+	CookiesDirName = "cookies"
+
+	// CookiesBindingType is the type of service bindings containing cookies
+	// in the entry "cookies"
+	CookiesBindingType = "git-cookies"
+)
+
+// IsCookie reports whether a credential authenticates with cookies
+func (c GitCredential) IsCookie() bool {
+	return c.Auth == AuthCookie
+}
+
+// HasCookieCredentials reports whether any credential authenticates with
+// cookies
+func (e BuildEnvironment) HasCookieCredentials() bool {
+	for _, credential := range e.BuildPackYML.Credentials {
+		if credential.IsCookie() {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigureCookies writes the cookies of all cookie credentials in Netscape
+// format into the given layer directory and directs GIT to send them via
+// http.<url>.cookieFile. The gitcredentials layer is never a launch layer, so
+// the cookies do not end up in the app image.
+func (e BuildEnvironment) ConfigureCookies(layerPath string) error {
+	e.Logger.Process("Configuring git to use cookies for authentication")
+
+	cookiesDir := filepath.Join(layerPath, CookiesDirName)
+	err := os.MkdirAll(cookiesDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	for i, credential := range e.BuildPackYML.Credentials {
+		if !credential.IsCookie() {
+			continue
+		}
+
+		cookies, err := e.resolveCookies(credential)
+		if err != nil {
+			return err
+		}
+
+		cookieFile := filepath.Join(cookiesDir, fmt.Sprintf("cookies_%d.txt", i))
+		err = ioutil.WriteFile(cookieFile, []byte(netscapeCookies(credential, cookies)), 0600)
+		if err != nil {
+			return err
+		}
+
+		err = e.RunGitCommand([]string{
+			"git",
+			"config",
+			"--global",
+			"http." + credential.configURL() + ".cookieFile",
+			cookieFile,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveCookies returns the inline cookies of a credential or the cookies of
+// the binding it references
+func (e BuildEnvironment) resolveCookies(credential GitCredential) (string, error) {
+	if credential.Cookies != "" {
+		return credential.Cookies, nil
+	}
+
+	bindings, err := ResolveBindings(CookiesBindingType, e.Context.Platform.Path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, binding := range bindings {
+		if binding.Name != credential.CookiesBinding {
+			continue
+		}
+
+		cookies, ok, err := bindingEntry(binding, "cookies")
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("service binding %q does not contain an entry \"cookies\"", binding.Name)
+		}
+
+		return cookies, nil
+	}
+
+	return "", fmt.Errorf("no service binding %q of type %s found", credential.CookiesBinding, CookiesBindingType)
+}
+
+// netscapeCookies converts cookies to the Netscape cookie file format. Lines
+// already in that format are kept, "name=value" lines become session cookies
+// for the host and path of the credential.
+func netscapeCookies(credential GitCredential, cookies string) string {
+	domain := credential.Host
+	path := credential.Path
+	secure := credential.Protocol == "https"
+	if credential.URL != "" {
+		credentialURL, err := url.Parse(credential.URL)
+		if err == nil {
+			domain = credentialURL.Host
+			secure = credentialURL.Scheme == "https"
+		}
+	}
+	if host, _, ok := strings.Cut(domain, ":"); ok {
+		domain = host
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	secureFlag := "FALSE"
+	if secure {
+		secureFlag = "TRUE"
+	}
+
+	var bf strings.Builder
+	bf.WriteString("# Netscape HTTP Cookie File\n")
+	for _, line := range strings.Split(cookies, "\n") {
+		// values may be empty, so trailing tabs are significant
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "# Netscape") {
+			continue
+		}
+
+		if strings.Count(line, "\t") == 6 || strings.HasPrefix(line, "#") {
+			bf.WriteString(line + "\n")
+			continue
+		}
+
+		name, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		bf.WriteString(strings.Join([]string{domain, "FALSE", path, secureFlag, "0", strings.TrimSpace(name), strings.TrimSpace(value)}, "\t") + "\n")
+	}
+
+	return bf.String()
+}
+
+// validateCookies checks that a cookie credential specifies cookies
+func validateCookies(credential GitCredential) error {
+	if credential.Cookies == "" && credential.CookiesBinding == "" {
+		return fmt.Errorf("cookie credential for %s specifies neither cookies nor cookies_binding", credential.Host)
+	}
+	if credential.Cookies != "" && credential.CookiesBinding != "" {
+		return fmt.Errorf("cookie credential for %s specifies both cookies and cookies_binding", credential.Host)
+	}
+	return nil
+}
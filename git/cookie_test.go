@@ -0,0 +1,121 @@
+package git_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testCookie(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		layerDir    string
+		platformDir string
+		output      *bytes.Buffer
+		env         git.BuildEnvironment
+	)
+
+	gitConfig := func(key string) string {
+		output, err := exec.Command("git", "config", "--global", key).Output()
+		Expect(err).NotTo(HaveOccurred())
+		return strings.TrimSpace(string(output))
+	}
+
+	it.Before(func() {
+		var err error
+		layerDir, err = ioutil.TempDir("", "layer")
+		Expect(err).NotTo(HaveOccurred())
+
+		platformDir, err = ioutil.TempDir("", "platform")
+		Expect(err).NotTo(HaveOccurred())
+
+		bindingDir := filepath.Join(platformDir, "bindings", "gerrit-cookies")
+		Expect(os.MkdirAll(bindingDir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(bindingDir, "type"), []byte("git-cookies"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(bindingDir, "cookies"), []byte(".googlesource.com\tTRUE\t/\tTRUE\t2147483647\to\tgit-user.example.com=b1nd1ng\n"), 0600)).To(Succeed())
+
+		output = &bytes.Buffer{}
+		env = git.BuildEnvironment{
+			Logger:  scribe.NewLogger(output),
+			Context: packit.BuildContext{Platform: packit.Platform{Path: platformDir}},
+			BuildPackYML: git.BuildPackYML{
+				Credentials: []git.GitCredential{
+					{Protocol: "https", Host: "github.com", Path: "/", Username: "user", Password: "token"},
+					{Protocol: "https", Host: "gerrit.example.com:8443", Path: "/a/", Auth: "cookie", Cookies: "GerritAccount = s3cr3t\n"},
+					{Protocol: "https", Host: "example.googlesource.com", Path: "/", Auth: "cookie", CookiesBinding: "gerrit-cookies"},
+				},
+			},
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(layerDir)).To(Succeed())
+		Expect(os.RemoveAll(platformDir)).To(Succeed())
+		for _, url := range []string{"https://gerrit.example.com:8443/a/", "https://example.googlesource.com/"} {
+			_ = exec.Command("git", "config", "--global", "--remove-section", "http."+url).Run()
+		}
+	})
+
+	it("detects cookie credentials", func() {
+		Expect(env.HasCookieCredentials()).To(BeTrue())
+
+		env.BuildPackYML.Credentials = env.BuildPackYML.Credentials[:1]
+		Expect(env.HasCookieCredentials()).To(BeFalse())
+	})
+
+	it("writes cookie files in Netscape format and configures them per URL without logging cookies", func() {
+		Expect(env.ConfigureCookies(layerDir)).To(Succeed())
+
+		cookiesDir := filepath.Join(layerDir, "cookies")
+		info, err := os.Stat(cookiesDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0700)))
+
+		for name, content := range map[string]string{
+			"cookies_1.txt": "# Netscape HTTP Cookie File\ngerrit.example.com\tFALSE\t/a/\tTRUE\t0\tGerritAccount\ts3cr3t\n",
+			"cookies_2.txt": "# Netscape HTTP Cookie File\n.googlesource.com\tTRUE\t/\tTRUE\t2147483647\to\tgit-user.example.com=b1nd1ng\n",
+		} {
+			path := filepath.Join(cookiesDir, name)
+			actual, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(actual)).To(Equal(content))
+
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		}
+
+		Expect(gitConfig("http.https://gerrit.example.com:8443/a/.cookieFile")).To(Equal(filepath.Join(cookiesDir, "cookies_1.txt")))
+		Expect(gitConfig("http.https://example.googlesource.com/.cookieFile")).To(Equal(filepath.Join(cookiesDir, "cookies_2.txt")))
+
+		Expect(output.String()).NotTo(ContainSubstring("s3cr3t"))
+		Expect(output.String()).NotTo(ContainSubstring("b1nd1ng"))
+	})
+
+	it("fails if the binding does not exist", func() {
+		env.BuildPackYML.Credentials[2].CookiesBinding = "missing"
+		Expect(env.ConfigureCookies(layerDir)).To(MatchError(`no service binding "missing" of type git-cookies found`))
+	})
+
+	it("requires exactly one of cookies and cookies_binding", func() {
+		env.BuildPackYML.Credentials = env.BuildPackYML.Credentials[1:]
+		env.BuildPackYML.Credentials[0].Cookies = ""
+		Expect(env.Configure()).To(MatchError("cookie credential for gerrit.example.com:8443 specifies neither cookies nor cookies_binding"))
+
+		env.BuildPackYML.Credentials[0].Cookies = "a=b"
+		env.BuildPackYML.Credentials[0].CookiesBinding = "gerrit-cookies"
+		Expect(env.Configure()).To(MatchError("cookie credential for gerrit.example.com:8443 specifies both cookies and cookies_binding"))
+	})
+}
@@ -0,0 +1,206 @@
+package git
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+const (
+	// CredentialHelperName is the name of the GIT credential helper binary
+	// within the bin directory of the buildpack
+	CredentialHelperName = "credential-helper"
+
+	// MintedCredentialsFileName is the name of the file in the layer directory
+	// which lists the credentials whose passwords the credential helper mints
+	MintedCredentialsFileName = "minted-credentials.json"
+)
+
+// CredentialHelperPath returns the path of the credential helper binary in the
+// given bin directory, or an empty string if it does not exist
+func CredentialHelperPath(binPath string) string {
+	path := filepath.Join(binPath, CredentialHelperName)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+
+	return path
+}
+
+// useCredentialHelper reports whether the password of a credential is minted
+// per request by the credential helper rather than stored in the GIT
+// credential cache, where it would outlive its expiry
+func (e BuildEnvironment) useCredentialHelper(credential GitCredential) bool {
+	return e.CredentialHelper != "" && credential.IsMinted() && !credential.IsSSH() && !credential.IsCookie() && !e.useExtraHeader(credential)
+}
+
+// ConfigureCredentialHelper writes the credentials whose passwords are minted
+// into the given layer directory and registers the credential helper for
+// their URLs. The list of helpers is reset for these URLs, so that the GIT
+// credential cache neither answers nor stores their expiring passwords.
+func (e BuildEnvironment) ConfigureCredentialHelper(layerPath string) error {
+	e.Logger.Process("Configuring GIT credential helper to mint passwords per request")
+
+	credentials, err := e.storedCredentials()
+	if err != nil {
+		return err
+	}
+
+	var minted []GitCredential
+	var credentialURLs []string
+	seen := map[string]bool{}
+	for _, credential := range credentials {
+		if !e.useCredentialHelper(credential) {
+			continue
+		}
+
+		credential.Password = ""
+		minted = append(minted, credential)
+
+		if !seen[credential.configURL()] {
+			seen[credential.configURL()] = true
+			credentialURLs = append(credentialURLs, credential.configURL())
+		}
+	}
+
+	content, err := json.Marshal(minted)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(layerPath, 0755)
+	if err != nil {
+		return err
+	}
+
+	credentialsPath := filepath.Join(layerPath, MintedCredentialsFileName)
+	err = ioutil.WriteFile(credentialsPath, content, 0600)
+	if err != nil {
+		return err
+	}
+
+	// a helper starting with "!" is run by the shell with the operation
+	// appended
+	helper := "!" + shellQuote(e.CredentialHelper) + " " + shellQuote(credentialsPath)
+	for _, credentialURL := range credentialURLs {
+		e.Logger.Subprocess("Minting passwords for %s", credentialURL)
+
+		// an empty value resets the list of helpers
+		for _, value := range []string{"", helper} {
+			err = e.RunGitCommand([]string{
+				"git",
+				"config",
+				"--global",
+				"--add",
+				"credential." + credentialURL + ".helper",
+				value,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// shellQuote quotes a value for the shell which runs GIT credential helpers
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// coversRequest reports whether a credential applies to the repository of a
+// request of the GIT credential helper protocol. Without useHttpPath GIT does
+// not send the path, then the host has to match.
+func (c GitCredential) coversRequest(request url.Values) bool {
+	if c.Protocol != request.Get("protocol") {
+		return false
+	}
+
+	covered := c.coveredHostPath()
+	if request.Get("path") == "" {
+		host, _, _ := strings.Cut(covered, "/")
+		return host == strings.ToLower(request.Get("host"))
+	}
+
+	return hostCovered([]string{covered}, normalizeHostPath(request.Get("host")+"/"+request.Get("path")))
+}
+
+// RunCredentialHelper implements the GIT credential helper protocol for the
+// credentials listed in the given file. For "get" it mints the password of
+// the first credential covering the requested repository, so that each
+// request gets a password which has not expired yet. "store" and "erase" are
+// ignored, minted passwords are never stored.
+func RunCredentialHelper(credentialsPath string, operation string, input io.Reader, output io.Writer) error {
+	request := url.Values{}
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, _ := strings.Cut(line, "=")
+		request.Add(key, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if operation != "get" {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(credentialsPath)
+	if err != nil {
+		return err
+	}
+
+	var credentials []GitCredential
+	err = json.Unmarshal(content, &credentials)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", credentialsPath, err)
+	}
+
+	authtype := false
+	for _, capability := range request["capability[]"] {
+		authtype = authtype || capability == "authtype"
+	}
+
+	for _, credential := range credentials {
+		if !credential.coversRequest(request) {
+			continue
+		}
+
+		minted, err := MintTokens([]GitCredential{credential}, scribe.NewLogger(ioutil.Discard))
+		if err != nil {
+			return err
+		}
+
+		for _, mintedCredential := range minted {
+			if !mintedCredential.coversRequest(request) {
+				continue
+			}
+
+			if mintedCredential.IsBearer() {
+				if !authtype {
+					return nil
+				}
+				_, err = fmt.Fprintf(output, "capability[]=authtype\nauthtype=Bearer\ncredential=%s\n", mintedCredential.Password)
+				return err
+			}
+
+			_, err = fmt.Fprintf(output, "username=%s\npassword=%s\n", mintedCredential.Username, mintedCredential.Password)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package git_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testCredentialHelper(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		server      *httptest.Server
+		exchanges   int
+		dir         string
+		idTokenFile string
+	)
+
+	it.Before(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "credential-helper")
+		Expect(err).NotTo(HaveOccurred())
+
+		idTokenFile = filepath.Join(dir, "token")
+		Expect(ioutil.WriteFile(idTokenFile, []byte("id-token\n"), 0600)).To(Succeed())
+
+		exchanges = 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			exchanges++
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"access_token": "access-token-%d", "token_type": "Bearer"}`, exchanges)
+		}))
+	})
+
+	it.After(func() {
+		server.Close()
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	context("RunCredentialHelper", func() {
+		var credentialsPath string
+
+		it.Before(func() {
+			content, err := json.Marshal([]git.GitCredential{
+				{Protocol: "https", Host: "git.example.com", Path: "/org", OIDCExchange: &git.OIDCExchange{TokenURL: server.URL, IDTokenFile: idTokenFile}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			credentialsPath = filepath.Join(dir, git.MintedCredentialsFileName)
+			Expect(ioutil.WriteFile(credentialsPath, content, 0600)).To(Succeed())
+		})
+
+		it("mints a new password for each request", func() {
+			for _, password := range []string{"access-token-1", "access-token-2"} {
+				var output bytes.Buffer
+				err := git.RunCredentialHelper(credentialsPath, "get", strings.NewReader("protocol=https\nhost=git.example.com\npath=org/repo.git\n\n"), &output)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(output.String()).To(Equal("username=oauth2\npassword=" + password + "\n"))
+			}
+		})
+
+		it("does not answer requests for other repositories", func() {
+			for _, request := range []string{
+				"protocol=https\nhost=git.example.org\n",
+				"protocol=https\nhost=git.example.com\npath=other/repo.git\n",
+				"protocol=http\nhost=git.example.com\n",
+			} {
+				var output bytes.Buffer
+				Expect(git.RunCredentialHelper(credentialsPath, "get", strings.NewReader(request), &output)).To(Succeed())
+				Expect(output.String()).To(BeEmpty())
+			}
+			Expect(exchanges).To(Equal(0))
+		})
+
+		it("ignores store and erase", func() {
+			for _, operation := range []string{"store", "erase"} {
+				var output bytes.Buffer
+				err := git.RunCredentialHelper(credentialsPath, operation, strings.NewReader("protocol=https\nhost=git.example.com\nusername=oauth2\npassword=access-token-1\n"), &output)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(output.String()).To(BeEmpty())
+			}
+			Expect(exchanges).To(Equal(0))
+		})
+	})
+
+	context("ConfigureGit", func() {
+		var layerDir string
+
+		it.Before(func() {
+			layerDir = filepath.Join(dir, "layer")
+		})
+
+		it.After(func() {
+			_ = exec.Command("git", "credential-cache", "exit").Run()
+			_ = exec.Command("git", "config", "--global", "--remove-section", "credential.https://git.example.com/").Run()
+			_ = exec.Command("git", "config", "--global", "--unset-all", "url.https://git.example.com/.insteadof").Run()
+			unsetGitCredentials()
+		})
+
+		it("bypasses the GIT credential cache for minted passwords", func() {
+			// stands in for the credential helper binary
+			helperPath := filepath.Join(dir, git.CredentialHelperName)
+			Expect(ioutil.WriteFile(helperPath, []byte("#!/bin/sh\ncat > /dev/null\n[ \"$2\" = get ] && echo password=fresh-token\nexit 0\n"), 0755)).To(Succeed())
+
+			env := git.BuildEnvironment{
+				BuildPackYML: git.BuildPackYML{Credentials: []git.GitCredential{
+					{Protocol: "https", Host: "git.example.com", Path: "/", Username: "oauth2", Password: "minted-token", OIDCExchange: &git.OIDCExchange{TokenURL: server.URL, IDTokenFile: idTokenFile}},
+				}},
+				Logger:           scribe.NewLogger(ioutil.Discard),
+				CredentialHelper: helperPath,
+			}
+
+			_, err := env.ConfigureGit(layerDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			credentialsPath := filepath.Join(layerDir, git.MintedCredentialsFileName)
+			output, err := exec.Command("git", "config", "--global", "--get-all", "credential.https://git.example.com/.helper").Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(output)).To(Equal("\n!'" + helperPath + "' '" + credentialsPath + "'\n"))
+
+			content, err := ioutil.ReadFile(credentialsPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(ContainSubstring(server.URL))
+			Expect(string(content)).NotTo(ContainSubstring("minted-token"))
+
+			info, err := os.Stat(credentialsPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			cmd := exec.Command("git", "credential", "fill")
+			cmd.Stdin = strings.NewReader("protocol=https\nhost=git.example.com\n\n")
+			output, err = cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(output)).To(ContainSubstring("password=fresh-token\n"))
+		})
+
+		it("caches minted passwords without the credential helper", func() {
+			env := git.BuildEnvironment{
+				BuildPackYML: git.BuildPackYML{Credentials: []git.GitCredential{
+					{Protocol: "https", Host: "git.example.com", Path: "/", Username: "oauth2", Password: "minted-token", OIDCExchange: &git.OIDCExchange{TokenURL: server.URL, IDTokenFile: idTokenFile}},
+				}},
+				Logger: scribe.NewLogger(ioutil.Discard),
+			}
+
+			_, err := env.ConfigureGit(layerDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Join(layerDir, git.MintedCredentialsFileName)).NotTo(BeAnExistingFile())
+
+			cmd := exec.Command("git", "credential", "fill")
+			cmd.Stdin = strings.NewReader("protocol=https\nhost=git.example.com\n\n")
+			output, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(output)).To(ContainSubstring("password=minted-token\n"))
+		})
+	})
+}
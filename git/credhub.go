@@ -0,0 +1,115 @@
+package git
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CredHubRefKey is the key VCAP_SERVICES uses for references to credentials
+// stored in CredHub
+const CredHubRefKey = "credhub-ref"
+
+// CredHubClient resolves CredHub references in VCAP_SERVICES using the
+// instance identity of a Cloud Foundry container for mutual TLS
+type CredHubClient struct {
+	APIURL     string
+	HTTPClient *http.Client
+}
+
+// NewCredHubClient creates a CredHubClient authenticating with the given
+// instance identity certificate and key. The CA certificates in caDir (usually
+// $CF_SYSTEM_CERT_PATH) are trusted in addition to the system's CAs.
+func NewCredHubClient(apiURL string, certPath string, keyPath string, caDir string) (CredHubClient, error) {
+	if apiURL == "" {
+		return CredHubClient{}, fmt.Errorf("VCAP_SERVICES contains CredHub references but CREDHUB_API is not set")
+	}
+
+	if certPath == "" || keyPath == "" {
+		return CredHubClient{}, fmt.Errorf("VCAP_SERVICES contains CredHub references but CF_INSTANCE_CERT or CF_INSTANCE_KEY is not set")
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return CredHubClient{}, fmt.Errorf("failed to load instance identity: %w", err)
+	}
+
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		rootCAs = x509.NewCertPool()
+	}
+
+	if caDir != "" {
+		caFiles, err := ioutil.ReadDir(caDir)
+		if err != nil && !os.IsNotExist(err) {
+			return CredHubClient{}, fmt.Errorf("failed to read CA certificates: %w", err)
+		}
+
+		for _, caFile := range caFiles {
+			if caFile.IsDir() {
+				continue
+			}
+
+			pem, err := ioutil.ReadFile(filepath.Join(caDir, caFile.Name()))
+			if err != nil {
+				return CredHubClient{}, fmt.Errorf("failed to read CA certificates: %w", err)
+			}
+			rootCAs.AppendCertsFromPEM(pem)
+		}
+	}
+
+	return CredHubClient{
+		APIURL: strings.TrimSuffix(apiURL, "/"),
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					Certificates: []tls.Certificate{certificate},
+					RootCAs:      rootCAs,
+					MinVersion:   tls.VersionTLS12,
+				},
+			},
+		},
+	}, nil
+}
+
+// Interpolate replaces all CredHub references in the given VCAP_SERVICES with
+// the credentials they refer to
+func (c CredHubClient) Interpolate(vcapServices string) (string, error) {
+	response, err := c.HTTPClient.Post(c.APIURL+"/api/v1/interpolate", "application/json", bytes.NewBufferString(vcapServices))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve CredHub references: %w", err)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve CredHub references: %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var credHubError struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &credHubError) == nil && credHubError.Error != "" {
+			return "", fmt.Errorf("failed to resolve CredHub references: CredHub returned status %d: %s", response.StatusCode, credHubError.Error)
+		}
+		return "", fmt.Errorf("failed to resolve CredHub references: CredHub returned status %d", response.StatusCode)
+	}
+
+	return string(body), nil
+}
+
+// ContainsCredHubRefs reports whether VCAP_SERVICES contains references to
+// credentials stored in CredHub
+func ContainsCredHubRefs(vcapServices string) bool {
+	return strings.Contains(vcapServices, `"`+CredHubRefKey+`"`)
+}
@@ -0,0 +1,155 @@
+package git_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testCredHub(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		server   *httptest.Server
+		dir      string
+		certPath string
+		keyPath  string
+		caDir    string
+		request  []byte
+	)
+
+	it.Before(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "credhub")
+		Expect(err).NotTo(HaveOccurred())
+
+		// instance identity certificate of the app container
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "app-instance"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+		clientCert, err := x509.ParseCertificate(der)
+		Expect(err).NotTo(HaveOccurred())
+
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		Expect(err).NotTo(HaveOccurred())
+
+		certPath = filepath.Join(dir, "instance.crt")
+		keyPath = filepath.Join(dir, "instance.key")
+		Expect(ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)).To(Succeed())
+
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v1/interpolate" || r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			request, _ = ioutil.ReadAll(r.Body)
+			if string(request) == "{}" {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"error": "The request could not be completed because the credential does not exist or you do not have sufficient authorization."}`))
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"user-provided": [{"name": "github", "tags": ["git-credentials"], "credentials": {"host": "github.com", "username": "user", "password": "token"}}]}`))
+		}))
+
+		clientCAs := x509.NewCertPool()
+		clientCAs.AddCert(clientCert)
+		server.TLS = &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  clientCAs,
+		}
+		server.StartTLS()
+
+		caDir = filepath.Join(dir, "cf-system-certificates")
+		Expect(os.MkdirAll(caDir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(caDir, "credhub.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)).To(Succeed())
+	})
+
+	it.After(func() {
+		server.Close()
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	context("NewCredHubClient", func() {
+		it("requires the CredHub API", func() {
+			_, err := git.NewCredHubClient("", certPath, keyPath, caDir)
+			Expect(err).To(MatchError("VCAP_SERVICES contains CredHub references but CREDHUB_API is not set"))
+		})
+
+		it("requires the instance identity", func() {
+			_, err := git.NewCredHubClient(server.URL, "", keyPath, caDir)
+			Expect(err).To(MatchError("VCAP_SERVICES contains CredHub references but CF_INSTANCE_CERT or CF_INSTANCE_KEY is not set"))
+		})
+
+		it("returns an error if the instance identity cannot be loaded", func() {
+			_, err := git.NewCredHubClient(server.URL, filepath.Join(dir, "missing"), keyPath, caDir)
+			Expect(err).To(MatchError(ContainSubstring("failed to load instance identity")))
+		})
+	})
+
+	context("Interpolate", func() {
+		it("resolves references via mutual TLS", func() {
+			client, err := git.NewCredHubClient(server.URL, certPath, keyPath, caDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			vcapServices := `{"user-provided": [{"name": "github", "tags": ["git-credentials"], "credentials": {"credhub-ref": "/c/user-provided/github"}}]}`
+			Expect(git.ContainsCredHubRefs(vcapServices)).To(BeTrue())
+
+			resolved, err := client.Interpolate(vcapServices)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(request)).To(Equal(vcapServices))
+			Expect(git.ContainsCredHubRefs(resolved)).To(BeFalse())
+
+			instances, err := git.ParseVCAPServices(resolved, "")
+			Expect(err).NotTo(HaveOccurred())
+			credentials, err := instances[0].GitCredentials()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials[0].Password).To(Equal("token"))
+		})
+
+		it("reports errors returned by CredHub", func() {
+			client, err := git.NewCredHubClient(server.URL, certPath, keyPath, caDir)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.Interpolate("{}")
+			Expect(err).To(MatchError("failed to resolve CredHub references: CredHub returned status 403: The request could not be completed because the credential does not exist or you do not have sufficient authorization."))
+		})
+
+		it("fails if the server is not trusted", func() {
+			client, err := git.NewCredHubClient(server.URL, certPath, keyPath, filepath.Join(dir, "missing"))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.Interpolate("{}")
+			Expect(err).To(MatchError(ContainSubstring("certificate")))
+		})
+	})
+}
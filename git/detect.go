@@ -50,11 +50,36 @@ func Detect(logger scribe.Logger) packit.DetectFunc {
 			}
 		}
 
+		gitProvider, providerExists := os.LookupEnv("GIT_CREDENTIALS_PROVIDER")
+		if providerExists && len(gitProvider) > 0 && passwordExists && len(gitPassword) > 0 {
+			logger.Process("Using environment variables GIT_CREDENTIALS_PROVIDER and GIT_CREDENTIALS_PASSWORD")
+			return detectResult, nil
+		}
+
 		BuildpackYML, err := BuildpackYMLParse(filepath.Join(context.WorkingDir, "buildpack.yml"))
 		if err == nil && len(BuildpackYML.Credentials) > 0 {
 			return detectResult, nil
 		}
 
+		sourcesConfigured, err := CredentialSourcesConfigured(context.WorkingDir, context.Platform.Path, BuildpackYML, logger)
+		if err != nil {
+			return packit.DetectResult{}, err
+		}
+
+		if sourcesConfigured {
+			return detectResult, nil
+		}
+
+		launchEnabled, err := LaunchEnabled(BuildpackYML)
+		if err != nil {
+			return packit.DetectResult{}, err
+		}
+
+		if launchEnabled {
+			logger.Process("Configuring git at runtime from service bindings")
+			return detectResult, nil
+		}
+
 		logger.Subprocess("Not participating: could not find GIT credentials in environment or in buildpack.yml")
 		logger.Break()
 		return packit.DetectResult{}, packit.Fail
@@ -0,0 +1,278 @@
+package git
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// GitHubAppBindingType is the type of service bindings containing the
+// configuration of a GitHub App
+const GitHubAppBindingType = "github-app"
+
+// DefaultGitHubAPIURL is the API used to mint GitHub App installation tokens
+// unless configured otherwise
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// GitHubAppUsername is the username GitHub expects for installation tokens
+const GitHubAppUsername = "x-access-token"
+
+// GitHubApp configures a credential whose password is an installation access
+// token of a GitHub App minted at build time
+type GitHubApp struct {
+	AppID          string            `yaml:"app_id" json:"app_id"`
+	InstallationID string            `yaml:"installation_id" json:"installation_id"`
+	PrivateKey     string            `yaml:"private_key" json:"private_key"`
+	APIURL         string            `yaml:"api_url" json:"api_url"`
+	Repositories   []string          `yaml:"repositories" json:"repositories"`
+	Permissions    map[string]string `yaml:"permissions" json:"permissions"`
+}
+
+// readGitHubAppSources returns GitHub App credentials configured by service
+// bindings of type "github-app" (entries "app-id", "installation-id",
+// "private-key", optionally "host", "api-url", "repositories" and
+// "permissions") and by the environment variables
+// GIT_CREDENTIALS_GITHUB_APP_ID, GIT_CREDENTIALS_GITHUB_APP_INSTALLATION_ID,
+// GIT_CREDENTIALS_GITHUB_APP_PRIVATE_KEY, GIT_CREDENTIALS_GITHUB_API_URL,
+// GIT_CREDENTIALS_GITHUB_APP_REPOSITORIES and
+// GIT_CREDENTIALS_GITHUB_APP_PERMISSIONS
+func readGitHubAppSources(platformPath string) ([]GitCredential, error) {
+	credentials, err := readGitHubAppBindings(platformPath)
+	if err != nil {
+		return nil, err
+	}
+
+	gitAppID, appIDExists := os.LookupEnv("GIT_CREDENTIALS_GITHUB_APP_ID")
+	if appIDExists && len(gitAppID) > 0 {
+		credential, err := newGitHubAppCredential(os.Getenv("GIT_CREDENTIALS_GITHUB_APP_HOST"), GitHubApp{
+			AppID:          gitAppID,
+			InstallationID: os.Getenv("GIT_CREDENTIALS_GITHUB_APP_INSTALLATION_ID"),
+			PrivateKey:     os.Getenv("GIT_CREDENTIALS_GITHUB_APP_PRIVATE_KEY"),
+			APIURL:         os.Getenv("GIT_CREDENTIALS_GITHUB_API_URL"),
+			Repositories:   splitList(os.Getenv("GIT_CREDENTIALS_GITHUB_APP_REPOSITORIES")),
+		}, os.Getenv("GIT_CREDENTIALS_GITHUB_APP_PERMISSIONS"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitHub App environment variables: %w", err)
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, nil
+}
+
+// readGitHubAppBindings returns GitHub App credentials configured by service
+// bindings of type "github-app"
+func readGitHubAppBindings(platformPath string) ([]GitCredential, error) {
+	var credentials []GitCredential
+
+	bindings, err := ResolveBindings(GitHubAppBindingType, platformPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, binding := range bindings {
+		entries := map[string]string{}
+		for _, name := range []string{"app-id", "installation-id", "private-key", "host", "api-url", "repositories", "permissions"} {
+			value, _, err := bindingEntry(binding, name)
+			if err != nil {
+				return nil, err
+			}
+			entries[name] = value
+		}
+
+		credential, err := newGitHubAppCredential(entries["host"], GitHubApp{
+			AppID:          entries["app-id"],
+			InstallationID: entries["installation-id"],
+			PrivateKey:     entries["private-key"],
+			APIURL:         entries["api-url"],
+			Repositories:   splitList(entries["repositories"]),
+		}, entries["permissions"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid service binding %s: %w", binding.Name, err)
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, nil
+}
+
+// newGitHubAppCredential creates a credential for a GitHub App. Permissions are
+// given as a list of name=access pairs, e.g. "contents=read,metadata=read".
+func newGitHubAppCredential(host string, app GitHubApp, permissions string) (GitCredential, error) {
+	if app.AppID == "" || app.InstallationID == "" || app.PrivateKey == "" {
+		return GitCredential{}, errors.New("a GitHub App requires an app ID, an installation ID and a private key")
+	}
+
+	for _, permission := range splitList(permissions) {
+		name, access, found := strings.Cut(permission, "=")
+		if !found {
+			return GitCredential{}, fmt.Errorf("invalid GitHub App permission %q, expected <name>=<access>", permission)
+		}
+
+		if app.Permissions == nil {
+			app.Permissions = map[string]string{}
+		}
+		app.Permissions[name] = access
+	}
+
+	if host == "" {
+		host = "github.com"
+	}
+
+	return GitCredential{
+		Protocol:  "https",
+		Host:      host,
+		Path:      "/",
+		GitHubApp: &app,
+	}, nil
+}
+
+// splitList splits lists given in environment variables and bindings, which
+// may be separated by commas, spaces or newlines
+func splitList(list string) []string {
+	fields := strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n'
+	})
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// MintGitHubAppToken exchanges a JWT signed with the private key of the app
+// for an installation access token, narrowed down to the configured
+// repositories and permissions
+func MintGitHubAppToken(app GitHubApp, httpClient *http.Client) (string, error) {
+	privateKey, err := parseRSAPrivateKey(app.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	jwt, err := signJWT(privateKey, map[string]interface{}{
+		// allow for clock drift, as recommended by GitHub
+		"iat": now.Add(-60 * time.Second).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": app.AppID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	body := map[string]interface{}{}
+	if len(app.Repositories) > 0 {
+		body["repositories"] = app.Repositories
+	}
+	if len(app.Permissions) > 0 {
+		body["permissions"] = app.Permissions
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	apiURL := app.APIURL
+	if apiURL == "" {
+		apiURL = DefaultGitHubAPIURL
+	}
+
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(apiURL, "/")+"/app/installations/"+app.InstallationID+"/access_tokens", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Accept", "application/vnd.github+json")
+	request.Header.Set("Authorization", "Bearer "+jwt)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to mint GitHub App installation token: %w", err)
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to mint GitHub App installation token: %w", err)
+	}
+
+	if response.StatusCode != http.StatusCreated {
+		var githubError struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(responseBody, &githubError) == nil && githubError.Message != "" {
+			return "", fmt.Errorf("failed to mint GitHub App installation token: GitHub returned status %d: %s", response.StatusCode, githubError.Message)
+		}
+		return "", fmt.Errorf("failed to mint GitHub App installation token: GitHub returned status %d", response.StatusCode)
+	}
+
+	var token struct {
+		Token string `json:"token"`
+	}
+	err = json.Unmarshal(responseBody, &token)
+	if err != nil || token.Token == "" {
+		return "", errors.New("failed to mint GitHub App installation token: GitHub did not return a token")
+	}
+
+	return token.Token, nil
+}
+
+// parseRSAPrivateKey parses a PEM encoded PKCS #1 or PKCS #8 RSA private key
+func parseRSAPrivateKey(privateKeyPEM string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, errors.New("GitHub App private key is not PEM encoded")
+	}
+
+	if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return privateKey, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("GitHub App private key is neither a PKCS #1 nor a PKCS #8 key")
+	}
+
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("GitHub App private key is not an RSA key")
+	}
+
+	return privateKey, nil
+}
+
+// signJWT returns a JWT with the given claims signed using RS256
+func signJWT(privateKey *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
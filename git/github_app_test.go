@@ -0,0 +1,194 @@
+package git_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testGitHubApp(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		server        *httptest.Server
+		privateKey    *rsa.PrivateKey
+		privateKeyPEM string
+		claims        map[string]interface{}
+		body          map[string]interface{}
+	)
+
+	it.Before(func() {
+		var err error
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		privateKeyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}))
+
+		claims = nil
+		body = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v3/app/installations/456/access_tokens" || r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+				return
+			}
+
+			jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			parts := strings.Split(jwt, ".")
+			if len(parts) != 3 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			if rsa.VerifyPKCS1v15(&privateKey.PublicKey, crypto.SHA256, digest[:], signature) != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"message": "A JSON web token could not be decoded"}`))
+				return
+			}
+
+			payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			_ = json.Unmarshal(payload, &claims)
+			_ = json.NewDecoder(r.Body).Decode(&body)
+
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"token": "ghs_installation", "expires_at": "2030-01-01T00:00:00Z"}`))
+		}))
+	})
+
+	it.After(func() {
+		server.Close()
+		os.Unsetenv("GIT_CREDENTIALS_GITHUB_APP_ID")
+		os.Unsetenv("GIT_CREDENTIALS_GITHUB_APP_INSTALLATION_ID")
+		os.Unsetenv("GIT_CREDENTIALS_GITHUB_APP_PRIVATE_KEY")
+		os.Unsetenv("GIT_CREDENTIALS_GITHUB_APP_PERMISSIONS")
+	})
+
+	context("MintGitHubAppToken", func() {
+		it("exchanges a signed JWT for an installation token", func() {
+			token, err := git.MintGitHubAppToken(git.GitHubApp{
+				AppID:          "123",
+				InstallationID: "456",
+				PrivateKey:     privateKeyPEM,
+				APIURL:         server.URL + "/api/v3/",
+				Repositories:   []string{"repo-a"},
+				Permissions:    map[string]string{"contents": "read"},
+			}, http.DefaultClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(Equal("ghs_installation"))
+
+			Expect(claims["iss"]).To(Equal("123"))
+			Expect(claims["exp"]).To(BeNumerically("<=", time.Now().Add(10*time.Minute).Unix()))
+			Expect(claims["iat"]).To(BeNumerically("<", time.Now().Unix()))
+			Expect(body).To(Equal(map[string]interface{}{
+				"repositories": []interface{}{"repo-a"},
+				"permissions":  map[string]interface{}{"contents": "read"},
+			}))
+		})
+
+		it("accepts PKCS #8 keys", func() {
+			pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			token, err := git.MintGitHubAppToken(git.GitHubApp{
+				AppID:          "123",
+				InstallationID: "456",
+				PrivateKey:     string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})),
+				APIURL:         server.URL + "/api/v3",
+			}, http.DefaultClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(Equal("ghs_installation"))
+			Expect(body).To(BeEmpty())
+		})
+
+		it("reports errors returned by GitHub", func() {
+			_, err := git.MintGitHubAppToken(git.GitHubApp{
+				AppID:          "123",
+				InstallationID: "789",
+				PrivateKey:     privateKeyPEM,
+				APIURL:         server.URL + "/api/v3",
+			}, http.DefaultClient)
+			Expect(err).To(MatchError("failed to mint GitHub App installation token: GitHub returned status 404: Not Found"))
+		})
+
+		it("rejects invalid private keys", func() {
+			_, err := git.MintGitHubAppToken(git.GitHubApp{PrivateKey: "not a key"}, http.DefaultClient)
+			Expect(err).To(MatchError("GitHub App private key is not PEM encoded"))
+		})
+	})
+
+	context("MintTokens", func() {
+		it("stores installation tokens with the x-access-token username", func() {
+			credentials, err := git.MintTokens([]git.GitCredential{
+				{Protocol: "https", Host: "github.com", Path: "/", Username: "user", Password: "token"},
+				{Protocol: "https", Host: "ghe.example.com", Path: "/", GitHubApp: &git.GitHubApp{
+					AppID:          "123",
+					InstallationID: "456",
+					PrivateKey:     privateKeyPEM,
+					APIURL:         server.URL + "/api/v3",
+				}},
+			}, scribe.NewLogger(ioutil.Discard))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials[0].Password).To(Equal("token"))
+			Expect(credentials[1].Username).To(Equal("x-access-token"))
+			Expect(credentials[1].Password).To(Equal("ghs_installation"))
+		})
+
+		it("returns credentials which are not minted unchanged", func() {
+			plain := []git.GitCredential{
+				{Host: "gitlab.com", Username: "user", Password: "token"},
+				{Host: "github.com", SSHKey: "key"},
+				{URL: "https://git.example.com", Username: "user", Password: "token", Auth: "bearer"},
+			}
+
+			credentials, err := git.MintTokens(plain, scribe.NewLogger(ioutil.Discard))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(Equal(plain))
+		})
+	})
+
+	context("environment variables", func() {
+		it("configures a GitHub App credential", func() {
+			os.Setenv("GIT_CREDENTIALS_GITHUB_APP_ID", "123")
+			os.Setenv("GIT_CREDENTIALS_GITHUB_APP_INSTALLATION_ID", "456")
+			os.Setenv("GIT_CREDENTIALS_GITHUB_APP_PRIVATE_KEY", privateKeyPEM)
+			os.Setenv("GIT_CREDENTIALS_GITHUB_APP_PERMISSIONS", "contents=read,metadata=read")
+
+			credentials, err := git.ReadCredentialSources("", "", git.BuildPackYML{}, scribe.NewLogger(ioutil.Discard))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(Equal([]git.GitCredential{
+				{Protocol: "https", Host: "github.com", Path: "/", GitHubApp: &git.GitHubApp{
+					AppID:          "123",
+					InstallationID: "456",
+					PrivateKey:     privateKeyPEM,
+					Permissions:    map[string]string{"contents": "read", "metadata": "read"},
+				}},
+			}))
+		})
+
+		it("requires all settings", func() {
+			os.Setenv("GIT_CREDENTIALS_GITHUB_APP_ID", "123")
+
+			_, err := git.ReadCredentialSources("", "", git.BuildPackYML{}, scribe.NewLogger(ioutil.Discard))
+			Expect(err).To(MatchError("invalid GitHub App environment variables: a GitHub App requires an app ID, an installation ID and a private key"))
+		})
+	})
+}
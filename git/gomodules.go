@@ -0,0 +1,139 @@
+package git
+
+import (
+	"os"
+	"strings"
+)
+
+// GoModuleEnvs are the environment variables of the Go toolchain which list
+// module path patterns that are fetched directly with GIT rather than via
+// the module proxy and are not verified against the checksum database
+var GoModuleEnvs = []string{"GOPRIVATE", "GONOSUMDB", "GONOPROXY"}
+
+// GoModulesEnabled reports whether GOPRIVATE, GONOSUMDB and GONOPROXY should be
+// derived from the credentials, either because "go_modules" is set in the
+// buildpack.yml or because the environment variable
+// GIT_CREDENTIALS_GO_MODULES is set to a true value
+func GoModulesEnabled(buildPackYML BuildPackYML) (bool, error) {
+	enabled, err := lookupEnvBool("GIT_CREDENTIALS_GO_MODULES")
+	if err != nil {
+		return false, err
+	}
+
+	return enabled || buildPackYML.GoModules, nil
+}
+
+// GoModulesHostsEnabled reports whether credentials for whole hosts add the
+// host to GOPRIVATE, GONOSUMDB and GONOPROXY, either because
+// "go_modules_hosts" is set in the buildpack.yml or because the environment
+// variable GIT_CREDENTIALS_GO_MODULES_HOSTS is set to a true value
+func GoModulesHostsEnabled(buildPackYML BuildPackYML) (bool, error) {
+	enabled, err := lookupEnvBool("GIT_CREDENTIALS_GO_MODULES_HOSTS")
+	if err != nil {
+		return false, err
+	}
+
+	return enabled || buildPackYML.GoModulesHosts, nil
+}
+
+// GoModulePatterns returns the module path patterns of the hosts and paths
+// covered by credentials, separated into patterns scoped to a path and
+// patterns of credentials for whole hosts. Module paths never contain a port,
+// so ports are dropped.
+func GoModulePatterns(credentials []GitCredential) ([]string, []string) {
+	var patterns []string
+	var hosts []string
+	seen := map[string]bool{}
+	for _, hostPath := range CoveredHosts(credentials) {
+		host, repoPath, _ := strings.Cut(hostPath, "/")
+		if name, _, found := strings.Cut(host, ":"); found {
+			host = name
+		}
+
+		pattern := host
+		if repoPath != "" {
+			pattern += "/" + repoPath
+		}
+		if seen[pattern] {
+			continue
+		}
+		seen[pattern] = true
+
+		if repoPath == "" {
+			hosts = append(hosts, pattern)
+		} else {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return patterns, hosts
+}
+
+// mergeGoPatterns appends the patterns to the comma separated list existing.
+// Patterns already matched by the list are skipped. It returns the merged
+// list and the patterns added.
+func mergeGoPatterns(existing string, patterns []string) (string, []string) {
+	var merged []string
+	for _, pattern := range strings.Split(existing, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			merged = append(merged, pattern)
+		}
+	}
+
+	var added []string
+	for _, pattern := range patterns {
+		if matchGoPatterns(strings.Join(merged, ","), pattern) {
+			continue
+		}
+		merged = append(merged, pattern)
+		added = append(added, pattern)
+	}
+
+	return strings.Join(merged, ","), added
+}
+
+// GoModulesEnv returns GOPRIVATE, GONOSUMDB and GONOPROXY with the module path
+// patterns of the credentials merged into the values the user already set,
+// and explains which patterns were added. The Go toolchain defaults GONOSUMDB
+// and GONOPROXY to GOPRIVATE while they are empty, so empty ones are seeded
+// with the GOPRIVATE of the user before merging. Credentials for whole hosts
+// would disable the checksum database for every module of the host, e.g. all
+// of github.com, so their hosts are only added if GoModulesHostsEnabled.
+func (e BuildEnvironment) GoModulesEnv() (map[string]string, error) {
+	e.Logger.Process("Configuring Go modules for hosts with credentials")
+
+	hostsEnabled, err := GoModulesHostsEnabled(e.BuildPackYML)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns, hosts := GoModulePatterns(e.BuildPackYML.Credentials)
+	if len(hosts) > 0 {
+		if hostsEnabled {
+			e.Logger.Subprocess("Warning: all modules of %s are fetched without the module proxy and are not verified against the checksum database", strings.Join(hosts, ", "))
+			patterns = append(patterns, hosts...)
+		} else {
+			e.Logger.Subprocess("Warning: skipping %s, the credentials cover whole hosts; list the module paths in GOPRIVATE or set go_modules_hosts to add the hosts", strings.Join(hosts, ", "))
+		}
+	}
+
+	env := map[string]string{}
+	for _, name := range GoModuleEnvs {
+		existing := os.Getenv(name)
+		if existing == "" {
+			existing = os.Getenv("GOPRIVATE")
+		}
+
+		merged, added := mergeGoPatterns(existing, patterns)
+		if len(added) > 0 {
+			e.Logger.Subprocess("%s: added %s", name, strings.Join(added, ", "))
+		} else {
+			e.Logger.Subprocess("%s: all module paths are already included", name)
+		}
+		env[name] = merged
+	}
+	e.Logger.Subprocess("Modules below these paths are fetched with git instead of via the module proxy and are not verified against the checksum database")
+	e.Logger.Break()
+
+	return env, nil
+}
@@ -0,0 +1,136 @@
+package git_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testGoModules(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		credentials []git.GitCredential
+	)
+
+	it.Before(func() {
+		credentials = []git.GitCredential{
+			{Protocol: "https", Host: "github.com", Path: "/acme/", Username: "user", Password: "token"},
+			{Protocol: "https", Host: "git.example.com:8443", Path: "/", Username: "user", Password: "pass"},
+			{Host: "gitlab.com", Path: "/group/repo.git", SSHKey: "key"},
+		}
+	})
+
+	context("GoModulesEnabled", func() {
+		it.After(func() {
+			os.Unsetenv("GIT_CREDENTIALS_GO_MODULES")
+		})
+
+		it("is disabled by default", func() {
+			enabled, err := git.GoModulesEnabled(git.BuildPackYML{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(enabled).To(BeFalse())
+		})
+
+		it("is enabled by the buildpack.yml or GIT_CREDENTIALS_GO_MODULES", func() {
+			enabled, err := git.GoModulesEnabled(git.BuildPackYML{GoModules: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(enabled).To(BeTrue())
+
+			os.Setenv("GIT_CREDENTIALS_GO_MODULES", "true")
+			enabled, err = git.GoModulesEnabled(git.BuildPackYML{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(enabled).To(BeTrue())
+		})
+	})
+
+	context("GoModulePatterns", func() {
+		it("separates path scoped patterns from whole hosts", func() {
+			patterns, hosts := git.GoModulePatterns(credentials)
+			Expect(patterns).To(Equal([]string{"github.com/acme", "gitlab.com/group/repo"}))
+			Expect(hosts).To(Equal([]string{"git.example.com"}))
+		})
+	})
+
+	context("GoModulesEnv", func() {
+		var (
+			buffer *bytes.Buffer
+			env    git.BuildEnvironment
+		)
+
+		it.Before(func() {
+			buffer = bytes.NewBuffer(nil)
+			env = git.BuildEnvironment{
+				Logger:       scribe.NewLogger(buffer),
+				BuildPackYML: git.BuildPackYML{Credentials: credentials},
+			}
+		})
+
+		it.After(func() {
+			os.Unsetenv("GOPRIVATE")
+			os.Unsetenv("GONOSUMDB")
+			os.Unsetenv("GONOPROXY")
+			os.Unsetenv("GIT_CREDENTIALS_GO_MODULES_HOSTS")
+		})
+
+		it("exports the path scoped patterns", func() {
+			Expect(env.GoModulesEnv()).To(Equal(map[string]string{
+				"GOPRIVATE": "github.com/acme,gitlab.com/group/repo",
+				"GONOSUMDB": "github.com/acme,gitlab.com/group/repo",
+				"GONOPROXY": "github.com/acme,gitlab.com/group/repo",
+			}))
+			Expect(buffer.String()).To(ContainSubstring("GOPRIVATE: added github.com/acme, gitlab.com/group/repo"))
+			Expect(buffer.String()).To(ContainSubstring("Warning: skipping git.example.com, the credentials cover whole hosts"))
+		})
+
+		it("adds whole hosts only on request", func() {
+			env.BuildPackYML.GoModulesHosts = true
+			Expect(env.GoModulesEnv()).To(Equal(map[string]string{
+				"GOPRIVATE": "github.com/acme,gitlab.com/group/repo,git.example.com",
+				"GONOSUMDB": "github.com/acme,gitlab.com/group/repo,git.example.com",
+				"GONOPROXY": "github.com/acme,gitlab.com/group/repo,git.example.com",
+			}))
+			Expect(buffer.String()).To(ContainSubstring("Warning: all modules of git.example.com are fetched without the module proxy and are not verified against the checksum database"))
+
+			env.BuildPackYML.GoModulesHosts = false
+			os.Setenv("GIT_CREDENTIALS_GO_MODULES_HOSTS", "true")
+			goModulesEnv, err := env.GoModulesEnv()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(goModulesEnv["GONOSUMDB"]).To(Equal("github.com/acme,gitlab.com/group/repo,git.example.com"))
+
+			os.Setenv("GIT_CREDENTIALS_GO_MODULES_HOSTS", "maybe")
+			_, err = env.GoModulesEnv()
+			Expect(err).To(MatchError(`invalid value for GIT_CREDENTIALS_GO_MODULES_HOSTS: "maybe" is not a boolean`))
+		})
+
+		it("merges the patterns with the values of the user", func() {
+			os.Setenv("GOPRIVATE", "corp.example.com/*,github.com/acme")
+			os.Setenv("GONOSUMDB", "gitlab.com")
+			os.Setenv("GONOPROXY", "*.example.com")
+
+			Expect(env.GoModulesEnv()).To(Equal(map[string]string{
+				"GOPRIVATE": "corp.example.com/*,github.com/acme,gitlab.com/group/repo",
+				"GONOSUMDB": "gitlab.com,github.com/acme",
+				"GONOPROXY": "*.example.com,github.com/acme,gitlab.com/group/repo",
+			}))
+			Expect(buffer.String()).To(ContainSubstring("GOPRIVATE: added gitlab.com/group/repo"))
+			Expect(buffer.String()).To(ContainSubstring("GONOSUMDB: added github.com/acme"))
+		})
+
+		it("seeds unset GONOSUMDB and GONOPROXY with GOPRIVATE of the user", func() {
+			os.Setenv("GOPRIVATE", "corp.example.com")
+
+			Expect(env.GoModulesEnv()).To(Equal(map[string]string{
+				"GOPRIVATE": "corp.example.com,github.com/acme,gitlab.com/group/repo",
+				"GONOSUMDB": "corp.example.com,github.com/acme,gitlab.com/group/repo",
+				"GONOPROXY": "corp.example.com,github.com/acme,gitlab.com/group/repo",
+			}))
+		})
+	})
+}
@@ -13,5 +13,33 @@ func TestUnitGitCredentials(t *testing.T) {
 	suite("BuildpackYMLParser", testBuildpackYMLParser)
 	suite("Detect", testDetect)
 	suite("Build", testBuild)
+	suite("Netrc", testNetrc)
+	suite("CredentialStore", testCredentialStore)
+	suite("Sources", testSources)
+	suite("SSH", testSSH)
+	suite("Tekton", testTekton)
+	suite("Kpack", testKpack)
+	suite("VCAP", testVCAP)
+	suite("CredHub", testCredHub)
+	suite("Vault", testVault)
+	suite("Provider", testProvider)
+	suite("Redact", testRedact)
+	suite("GitHubApp", testGitHubApp)
+	suite("OIDC", testOIDC)
+	suite("CodeCommit", testCodeCommit)
+	suite("Preset", testPreset)
+	suite("Auth", testAuth)
+	suite("TLS", testTLS)
+	suite("Proxy", testProxy)
+	suite("Mirror", testMirror)
+	suite("Prefetch", testPrefetch)
+	suite("LFS", testLFS)
+	suite("Cookie", testCookie)
+	suite("Launch", testLaunch)
+	suite("CredentialHelper", testCredentialHelper)
+	suite("Cleanup", testCleanup)
+	suite("Requirements", testRequirements)
+	suite("Manifests", testManifests)
+	suite("GoModules", testGoModules)
 	suite.Run(t)
 }
@@ -0,0 +1,109 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultKpackSecretsDir is the directory kpack mounts secrets to in its own
+// steps, secrets mounted into the build are expected there as well. It can be
+// overridden with GIT_CREDENTIALS_KPACK_DIR.
+const DefaultKpackSecretsDir = "/var/build-secrets"
+
+// KpackGitEnv is the environment variable mapping kpack secrets to the GIT
+// servers they are used for, i.e. the values of their "kpack.io/git"
+// annotations, in the format of the -basic-git and -ssh-git flags of the kpack
+// build-init, e.g. "github=https://github.com,gitlab=git@gitlab.com"
+const KpackGitEnv = "GIT_CREDENTIALS_KPACK_GIT"
+
+// ReadKpackCredentials reads the kpack secrets listed in gitServers from the
+// given directory. kpack mounts GIT secrets only into its prepare step, so
+// they have to be mounted into the build as well, each one as a Kubernetes
+// secret volume in a subdirectory named like the secret. Neither the volume
+// nor the environment carries the annotations of a secret, therefore
+// gitServers maps secret names to GIT servers in the format of KpackGitEnv.
+// kubernetes.io/basic-auth secrets (entries "username" and "password") are
+// mapped to HTTPs credentials and kubernetes.io/ssh-auth secrets (entry
+// "ssh-privatekey" and optionally "known_hosts") to SSH credentials.
+func ReadKpackCredentials(dir string, gitServers string) ([]GitCredential, error) {
+	var credentials []GitCredential
+	for _, entry := range splitList(gitServers) {
+		secret, gitServer, found := strings.Cut(entry, "=")
+		if !found || secret == "" || gitServer == "" {
+			return nil, fmt.Errorf("invalid %s entry %q, expected <secret>=<git server>", KpackGitEnv, entry)
+		}
+
+		secretDir := filepath.Join(dir, secret)
+		credential, ok, err := readKpackSecret(secretDir, gitServer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kpack secret %s: %w", secret, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("kpack secret %s is not mounted at %s, it requires either username and password or ssh-privatekey", secret, secretDir)
+		}
+
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, nil
+}
+
+// readKpackSecret maps a single kpack secret to a credential for the given GIT
+// server
+func readKpackSecret(secretDir string, gitServer string) (GitCredential, bool, error) {
+	entries := map[string]string{}
+	for _, name := range []string{"username", "password", "ssh-privatekey", "known_hosts"} {
+		content, err := ioutil.ReadFile(filepath.Join(secretDir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return GitCredential{}, false, err
+		}
+		entries[name] = string(content)
+	}
+
+	if key, ok := entries["ssh-privatekey"]; ok {
+		// SSH servers are given as e.g. "git@github.com"
+		user, host := "git", gitServer
+		if at := strings.LastIndex(gitServer, "@"); at >= 0 {
+			user, host = gitServer[:at], gitServer[at+1:]
+		}
+
+		return GitCredential{
+			Protocol:   "ssh",
+			Host:       host,
+			Username:   user,
+			SSHKey:     key,
+			KnownHosts: entries["known_hosts"],
+		}, true, nil
+	}
+
+	username, hasUsername := entries["username"]
+	password, hasPassword := entries["password"]
+	if !hasUsername || !hasPassword {
+		return GitCredential{}, false, nil
+	}
+
+	// HTTPs servers are given as e.g. "https://github.com"
+	server, err := url.Parse(gitServer)
+	if err != nil || server.Host == "" {
+		return GitCredential{}, false, fmt.Errorf("invalid GIT server %q", gitServer)
+	}
+
+	path := server.Path
+	if path == "" {
+		path = "/"
+	}
+
+	return GitCredential{
+		Protocol: server.Scheme,
+		Host:     server.Host,
+		Path:     path,
+		Username: strings.TrimSpace(username),
+		Password: strings.TrimSpace(password),
+	}, true, nil
+}
@@ -0,0 +1,93 @@
+package git_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testKpack(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		secretsDir string
+	)
+
+	// writeSecret lays out a secret like a Kubernetes secret volume: the
+	// entries are symlinks into a timestamped directory linked by ..data
+	writeSecret := func(name string, entries map[string]string) {
+		dir := filepath.Join(secretsDir, name)
+		dataDir := filepath.Join(dir, "..2024_01_01_00_00_00.000000000")
+		Expect(os.MkdirAll(dataDir, 0755)).To(Succeed())
+		Expect(os.Symlink(filepath.Base(dataDir), filepath.Join(dir, "..data"))).To(Succeed())
+		for entry, content := range entries {
+			Expect(ioutil.WriteFile(filepath.Join(dataDir, entry), []byte(content), 0644)).To(Succeed())
+			Expect(os.Symlink(filepath.Join("..data", entry), filepath.Join(dir, entry))).To(Succeed())
+		}
+	}
+
+	it.Before(func() {
+		var err error
+		secretsDir, err = ioutil.TempDir("", "build-secrets")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(secretsDir)).To(Succeed())
+	})
+
+	it("returns no credentials if no secrets are mapped to GIT servers", func() {
+		writeSecret("github", map[string]string{
+			"username": "user",
+			"password": "token",
+		})
+
+		credentials, err := git.ReadKpackCredentials(secretsDir, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credentials).To(BeEmpty())
+	})
+
+	it("maps basic-auth and ssh-auth secrets to credentials for their GIT servers", func() {
+		writeSecret("github", map[string]string{
+			"username": "user\n",
+			"password": "token\n",
+		})
+		writeSecret("gitlab-ssh", map[string]string{
+			"ssh-privatekey": "private-key",
+			"known_hosts":    "gitlab.com ssh-ed25519 AAAA",
+		})
+		writeSecret("unmapped", map[string]string{
+			"username": "other",
+			"password": "other",
+		})
+
+		credentials, err := git.ReadKpackCredentials(secretsDir, "github=https://github.com,gitlab-ssh=git@gitlab.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credentials).To(Equal([]git.GitCredential{
+			{Protocol: "https", Host: "github.com", Path: "/", Username: "user", Password: "token"},
+			{Protocol: "ssh", Host: "gitlab.com", Username: "git", SSHKey: "private-key", KnownHosts: "gitlab.com ssh-ed25519 AAAA"},
+		}))
+	})
+
+	it("returns an error for invalid mappings", func() {
+		writeSecret("github", map[string]string{
+			"username": "user",
+			"password": "token",
+		})
+
+		_, err := git.ReadKpackCredentials(secretsDir, "github")
+		Expect(err).To(MatchError(`invalid GIT_CREDENTIALS_KPACK_GIT entry "github", expected <secret>=<git server>`))
+
+		_, err = git.ReadKpackCredentials(secretsDir, "github=github.com")
+		Expect(err).To(MatchError(`failed to read kpack secret github: invalid GIT server "github.com"`))
+
+		_, err = git.ReadKpackCredentials(secretsDir, "missing=https://github.com")
+		Expect(err).To(MatchError("kpack secret missing is not mounted at " + filepath.Join(secretsDir, "missing") + ", it requires either username and password or ssh-privatekey"))
+	})
+}
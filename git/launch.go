@@ -0,0 +1,213 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/fs"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// LaunchLayerName is the name of the launch layer containing the exec.d
+	// binary which configures GIT at container start
+	LaunchLayerName = "gitcredentials-launch"
+
+	// LaunchExecDName is the name of the exec.d binary within the bin
+	// directory of the buildpack
+	LaunchExecDName = "launch"
+
+	// LaunchCacheTimeout is the number of seconds the GIT credential cache
+	// of a running app keeps credentials, i.e. one year. Minted passwords
+	// expire much earlier, they are never cached but minted per request by
+	// the credential helper.
+	LaunchCacheTimeout = 365 * 24 * 60 * 60
+)
+
+// LaunchEnabled reports whether GIT should be configured at container start,
+// either because "launch" is set in the buildpack.yml or because the
+// environment variable GIT_CREDENTIALS_LAUNCH is set to a true value
+func LaunchEnabled(buildPackYML BuildPackYML) (bool, error) {
+	enabled, err := lookupEnvBool("GIT_CREDENTIALS_LAUNCH")
+	if err != nil {
+		return false, err
+	}
+
+	return enabled || buildPackYML.Launch, nil
+}
+
+// NewLaunchLayer turns the given layer into a launch layer whose exec.d binary
+// configures GIT at container start. The layer contains no credentials, they
+// are resolved from the service bindings of the running container. The
+// credential helper which mints expiring passwords per request is copied into
+// the bin directory of the layer, the buildpack is not available at runtime.
+func NewLaunchLayer(layer packit.Layer, cnbPath string) (packit.Layer, error) {
+	layer, err := layer.Reset()
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	credentialHelper := CredentialHelperPath(filepath.Join(cnbPath, "bin"))
+	if credentialHelper != "" {
+		err = os.MkdirAll(filepath.Join(layer.Path, "bin"), 0755)
+		if err != nil {
+			return packit.Layer{}, err
+		}
+
+		err = fs.Copy(credentialHelper, filepath.Join(layer.Path, "bin", CredentialHelperName))
+		if err != nil {
+			return packit.Layer{}, err
+		}
+	}
+
+	layer.Build = false
+	layer.Cache = false
+	layer.Launch = true
+	layer.ExecD = []string{filepath.Join(cnbPath, "bin", LaunchExecDName)}
+
+	return layer, nil
+}
+
+// ReadLaunchBindings collects the credentials and settings available to a
+// running app. Only service bindings are taken into account, never anything
+// that was available at build time:
+//   - git-credentials bindings with the entry "credentials" in the format of
+//     the GIT credential store and / or the entry "config" which has the same
+//     structure as the gitcredentials section of a buildpack.yml; of the
+//     latter only credentials, netrc, proxy and mirrors are used
+//   - github-app bindings
+//   - codecommit bindings
+func ReadLaunchBindings(platformPath string, logger scribe.Logger) (BuildPackYML, error) {
+	var buildPackYML BuildPackYML
+
+	bindings, err := ResolveBindings(CredentialsBindingType, platformPath)
+	if err != nil {
+		return BuildPackYML{}, err
+	}
+
+	for _, binding := range bindings {
+		content, ok, err := bindingEntry(binding, "config")
+		if err != nil {
+			return BuildPackYML{}, err
+		}
+		if !ok {
+			continue
+		}
+
+		logger.Process("Using configuration from service binding %s", binding.Name)
+		var config BuildPackYML
+		err = yaml.Unmarshal([]byte(content), &config)
+		if err != nil {
+			return BuildPackYML{}, fmt.Errorf("failed to parse entry config of service binding %s: %w", binding.Name, err)
+		}
+
+		buildPackYML.Credentials = append(buildPackYML.Credentials, config.Credentials...)
+		buildPackYML.Netrc = buildPackYML.Netrc || config.Netrc
+		buildPackYML.Mirrors = append(buildPackYML.Mirrors, config.Mirrors...)
+		if config.Proxy.URL != "" {
+			buildPackYML.Proxy = config.Proxy
+		}
+	}
+
+	mirrorCredentials, err := MirrorCredentials(buildPackYML.Mirrors)
+	if err != nil {
+		return BuildPackYML{}, err
+	}
+	buildPackYML.Credentials = append(buildPackYML.Credentials, mirrorCredentials...)
+
+	bindingCredentials, err := readCredentialsBindings(platformPath, logger)
+	if err != nil {
+		return BuildPackYML{}, err
+	}
+	buildPackYML.Credentials = append(buildPackYML.Credentials, bindingCredentials...)
+
+	gitHubAppCredentials, err := readGitHubAppBindings(platformPath)
+	if err != nil {
+		return BuildPackYML{}, err
+	}
+	if len(gitHubAppCredentials) > 0 {
+		logger.Process("Using GitHub App credentials")
+		buildPackYML.Credentials = append(buildPackYML.Credentials, gitHubAppCredentials...)
+	}
+
+	codeCommitCredentials, err := readCodeCommitBindings(platformPath)
+	if err != nil {
+		return BuildPackYML{}, err
+	}
+	if len(codeCommitCredentials) > 0 {
+		logger.Process("Using CodeCommit credentials")
+		buildPackYML.Credentials = append(buildPackYML.Credentials, codeCommitCredentials...)
+	}
+
+	return buildPackYML, nil
+}
+
+// Launch configures GIT for the app at container start. It is run by the
+// exec.d binary of the launch layer and writes the environment variables of
+// the app process in TOML format to envWriter. Files such as SSH keys are
+// written into a private temporary directory. Minted passwords are minted per
+// request by the credential helper in the given bin directory of the launch
+// layer.
+func Launch(logger scribe.Logger, platformPath string, binPath string, envWriter io.Writer) error {
+	buildPackYML, err := ReadLaunchBindings(platformPath, logger)
+	if err != nil {
+		return err
+	}
+
+	if len(buildPackYML.Credentials) == 0 {
+		logger.Process("No credentials were found in service bindings, git is not configured")
+		return nil
+	}
+
+	buildPackYML.Credentials, err = ApplyProviderPresets(buildPackYML.Credentials)
+	if err != nil {
+		return err
+	}
+
+	buildPackYML.Credentials, err = MintTokens(buildPackYML.Credentials, logger)
+	if err != nil {
+		return err
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	env := BuildEnvironment{
+		BuildPackYML: buildPackYML,
+		Context: packit.BuildContext{
+			WorkingDir: workingDir,
+			Platform:   packit.Platform{Path: platformPath},
+		},
+		Logger:           logger,
+		CacheTimeout:     LaunchCacheTimeout,
+		CredentialHelper: CredentialHelperPath(binPath),
+	}
+
+	if env.HasBearerCredentials() {
+		env.GitVersion, err = DetectGitVersion()
+		if err != nil {
+			return err
+		}
+	}
+
+	// ioutil.TempDir creates the directory with mode 0700
+	runtimeDir, err := ioutil.TempDir("", "gitcredentials")
+	if err != nil {
+		return err
+	}
+
+	launchEnv, err := env.ConfigureGit(runtimeDir)
+	if err != nil {
+		return err
+	}
+
+	return toml.NewEncoder(envWriter).Encode(launchEnv)
+}
@@ -0,0 +1,222 @@
+package git
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LFSDirName is the name of the directory within the gitcredentials layer
+// containing the GIT configuration files with the LFS URLs
+const LFSDirName = "lfs"
+
+// LFSAccessModes are the values supported by lfs.<url>.access
+var LFSAccessModes = []string{"basic", "negotiate", "none"}
+
+// MinLFSURLGitVersion is the first version of GIT supporting
+// includeIf "hasconfig:remote.*.url:...", which scopes the LFS URL of a
+// credential to the repositories it covers
+var MinLFSURLGitVersion = GitVersion{Major: 2, Minor: 36}
+
+// LFSConfig represents the Git LFS settings of a credential
+type LFSConfig struct {
+	// URL is the LFS endpoint, e.g. https://lfs.example.com/org/repo.git/info/lfs.
+	// If it is not specified, git-lfs derives the endpoint from the remote.
+	URL string `yaml:"url" json:"url"`
+
+	// Access is the authentication mode of the LFS endpoint, see
+	// LFSAccessModes
+	Access string `yaml:"access" json:"access"`
+
+	// SkipSmudge disables downloading LFS objects on checkout via
+	// $GIT_LFS_SKIP_SMUDGE
+	SkipSmudge bool `yaml:"skip_smudge" json:"skip_smudge"`
+}
+
+// HasLFSConfig reports whether any credential specifies LFS settings
+func (e BuildEnvironment) HasLFSConfig() bool {
+	for _, credential := range e.BuildPackYML.Credentials {
+		if credential.LFS != nil && !credential.IsSSH() {
+			return true
+		}
+	}
+	return false
+}
+
+// lfsCredential returns a copy of the credential for its LFS endpoint, so
+// that requests to the endpoint reuse the stored credential
+func (c GitCredential) lfsCredential() (GitCredential, bool, error) {
+	if c.LFS == nil || c.LFS.URL == "" || c.IsSSH() {
+		return GitCredential{}, false, nil
+	}
+
+	endpoint, err := url.Parse(c.LFS.URL)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return GitCredential{}, false, fmt.Errorf("invalid LFS URL %q of %s: a protocol and host are required", c.LFS.URL, c.Host)
+	}
+
+	lfs := c
+	lfs.Protocol = endpoint.Scheme
+	lfs.Host = endpoint.Host
+	lfs.Path = endpoint.EscapedPath()
+	lfs.URL = ""
+	if lfs.Path == "" {
+		lfs.Path = "/"
+	}
+
+	return lfs, true, nil
+}
+
+// storedCredentials returns the credentials to be added to the GIT credential
+// cache, i.e. all credentials followed by a copy for each LFS endpoint
+func (e BuildEnvironment) storedCredentials() ([]GitCredential, error) {
+	credentials := append([]GitCredential{}, e.BuildPackYML.Credentials...)
+	for _, credential := range e.BuildPackYML.Credentials {
+		lfs, ok, err := credential.lfsCredential()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			credentials = append(credentials, lfs)
+		}
+	}
+
+	return credentials, nil
+}
+
+// ConfigureLFS configures the LFS endpoint of each credential via lfs.url and
+// its authentication mode via lfs.<url>.access. lfs.url is written to a file
+// in the given layer directory which is only included for repositories whose
+// remote URL is covered by the credential, so that other repositories keep
+// their own LFS servers. It reports whether downloading LFS objects should be
+// skipped.
+func (e BuildEnvironment) ConfigureLFS(layerPath string) (bool, error) {
+	e.Logger.Process("Configuring git LFS")
+
+	skipSmudge := false
+	for i, credential := range e.BuildPackYML.Credentials {
+		if credential.LFS == nil || credential.IsSSH() {
+			continue
+		}
+
+		if credential.LFS.SkipSmudge {
+			skipSmudge = true
+		}
+
+		endpoint := credential.configURL()
+		lfs, ok, err := credential.lfsCredential()
+		if err != nil {
+			return false, err
+		}
+
+		if ok {
+			endpoint = credential.LFS.URL
+
+			err = e.configureLFSURL(layerPath, i, credential)
+			if err != nil {
+				return false, err
+			}
+
+			if e.useExtraHeader(lfs) {
+				header := "Authorization: Bearer " + lfs.Password
+				err = e.runGitCommand([]string{
+					"git",
+					"config",
+					"--global",
+					"--add",
+					"http." + lfs.configURL() + ".extraHeader",
+					header,
+				}, header, lfs.Password)
+				if err != nil {
+					return false, err
+				}
+			}
+		}
+
+		if credential.LFS.Access != "" {
+			if !containsString(LFSAccessModes, credential.LFS.Access) {
+				return false, fmt.Errorf("unknown LFS access mode %q of %s, supported values are: basic, negotiate, none", credential.LFS.Access, credential.Host)
+			}
+
+			err = e.RunGitCommand([]string{
+				"git",
+				"config",
+				"--global",
+				"lfs." + endpoint + ".access",
+				credential.LFS.Access,
+			})
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return skipSmudge, nil
+}
+
+// configureLFSURL writes lfs.url of the i-th credential to a file in the
+// layer directory and includes it for all remote URLs below the URL of the
+// credential
+func (e BuildEnvironment) configureLFSURL(layerPath string, i int, credential GitCredential) error {
+	gitVersion := e.GitVersion
+	if gitVersion == (GitVersion{}) {
+		var err error
+		gitVersion, err = DetectGitVersion()
+		if err != nil {
+			return err
+		}
+	}
+	if !gitVersion.AtLeast(MinLFSURLGitVersion) {
+		return fmt.Errorf("the LFS URL of %s requires git %s or later, found %s", credential.Host, MinLFSURLGitVersion, gitVersion)
+	}
+
+	lfsDir := filepath.Join(layerPath, LFSDirName)
+	err := os.MkdirAll(lfsDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	configPath := filepath.Join(lfsDir, fmt.Sprintf("lfs_%d.gitconfig", i))
+	err = e.RunGitCommand([]string{
+		"git",
+		"config",
+		"--file",
+		configPath,
+		"lfs.url",
+		credential.LFS.URL,
+	})
+	if err != nil {
+		return err
+	}
+
+	repositoryURL := strings.TrimSuffix(credential.configURL(), "/")
+	for _, pattern := range []string{repositoryURL, repositoryURL + "/**"} {
+		err = e.RunGitCommand([]string{
+			"git",
+			"config",
+			"--global",
+			"--add",
+			"includeIf.hasconfig:remote.*.url:" + pattern + ".path",
+			configPath,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	e.Logger.Subprocess("Using LFS URL %s for %s", credential.LFS.URL, credential.configURL())
+
+	return nil
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
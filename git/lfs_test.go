@@ -0,0 +1,141 @@
+package git_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testLFS(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		env      git.BuildEnvironment
+		layerDir string
+	)
+
+	gitConfig := func(key string) string {
+		output, err := exec.Command("git", "config", "--global", key).Output()
+		Expect(err).NotTo(HaveOccurred())
+		return strings.TrimSpace(string(output))
+	}
+
+	repoConfig := func(remote string, key string) (string, error) {
+		repoDir, err := ioutil.TempDir("", "repo")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(repoDir)
+
+		Expect(exec.Command("git", "init", "--quiet", repoDir).Run()).To(Succeed())
+		Expect(exec.Command("git", "-C", repoDir, "remote", "add", "origin", remote).Run()).To(Succeed())
+
+		output, err := exec.Command("git", "-C", repoDir, "config", key).Output()
+		return strings.TrimSpace(string(output)), err
+	}
+
+	it.Before(func() {
+		var err error
+		layerDir, err = ioutil.TempDir("", "layer")
+		Expect(err).NotTo(HaveOccurred())
+
+		env = git.BuildEnvironment{
+			Logger: scribe.NewLogger(ioutil.Discard),
+			BuildPackYML: git.BuildPackYML{
+				Credentials: []git.GitCredential{
+					{
+						Protocol: "https", Host: "git.example.com", Path: "/", Username: "user", Password: "lfs-token",
+						LFS: &git.LFSConfig{URL: "https://lfs.example.com/org/repo.git/info/lfs", Access: "basic", SkipSmudge: true},
+					},
+					{
+						Protocol: "https", Host: "git.example.org", Path: "/", Username: "user", Password: "token",
+						LFS: &git.LFSConfig{Access: "negotiate"},
+					},
+				},
+			},
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(layerDir)).To(Succeed())
+
+		output, _ := exec.Command("git", "config", "--global", "--name-only", "--get-regexp", `^includeif\.`).Output()
+		for _, key := range strings.Fields(string(output)) {
+			_ = exec.Command("git", "config", "--global", "--unset-all", key).Run()
+		}
+		for _, section := range []string{
+			"lfs",
+			"lfs.https://lfs.example.com/org/repo.git/info/lfs",
+			"lfs.https://git.example.org/",
+			"lfs.https://lfs.example.org/",
+		} {
+			_ = exec.Command("git", "config", "--global", "--remove-section", section).Run()
+		}
+		_ = exec.Command("git", "credential-cache", "exit").Run()
+		_ = exec.Command("git", "config", "--global", "--unset", "credential.helper").Run()
+	})
+
+	it("detects LFS settings", func() {
+		Expect(env.HasLFSConfig()).To(BeTrue())
+
+		env.BuildPackYML.Credentials[0].LFS = nil
+		env.BuildPackYML.Credentials[1].LFS = nil
+		Expect(env.HasLFSConfig()).To(BeFalse())
+	})
+
+	it("configures the LFS endpoint and access modes", func() {
+		skipSmudge, err := env.ConfigureLFS(layerDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(skipSmudge).To(BeTrue())
+
+		Expect(gitConfig("lfs.https://lfs.example.com/org/repo.git/info/lfs.access")).To(Equal("basic"))
+		Expect(gitConfig("lfs.https://git.example.org/.access")).To(Equal("negotiate"))
+	})
+
+	it("scopes the LFS URL to the repositories covered by the credential", func() {
+		env.BuildPackYML.Credentials[1].LFS.URL = "https://lfs.example.org/"
+
+		_, err := env.ConfigureLFS(layerDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = exec.Command("git", "config", "--global", "lfs.url").Output()
+		Expect(err).To(HaveOccurred())
+
+		lfsURL, err := repoConfig("https://git.example.com/org/repo.git", "lfs.url")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lfsURL).To(Equal("https://lfs.example.com/org/repo.git/info/lfs"))
+
+		lfsURL, err = repoConfig("https://git.example.org/team/assets", "lfs.url")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lfsURL).To(Equal("https://lfs.example.org/"))
+
+		// another LFS repository keeps the endpoint derived from its remote
+		_, err = repoConfig("https://git.example.net/org/other.git", "lfs.url")
+		Expect(err).To(HaveOccurred())
+	})
+
+	it("stores the credential for the LFS endpoint", func() {
+		Expect(env.Initialize()).To(Succeed())
+		Expect(env.StoreCredentials()).To(Succeed())
+
+		cmd := exec.Command("git", "credential", "fill")
+		cmd.Stdin = strings.NewReader("protocol=https\nhost=lfs.example.com\n\n")
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		output, err := cmd.Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(ContainSubstring("username=user\n"))
+		Expect(string(output)).To(ContainSubstring("password=lfs-token\n"))
+	})
+
+	it("rejects unknown access modes", func() {
+		env.BuildPackYML.Credentials[1].LFS = &git.LFSConfig{Access: "kerberos"}
+		_, err := env.ConfigureLFS(layerDir)
+		Expect(err).To(MatchError(`unknown LFS access mode "kerberos" of git.example.org, supported values are: basic, negotiate, none`))
+	})
+}
@@ -0,0 +1,467 @@
+package git
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ManifestFiles are the dependency manifests scanned for Git URLs
+var ManifestFiles = []string{
+	"Gemfile",
+	"Gemfile.lock",
+	"go.mod",
+	"package.json",
+	"package-lock.json",
+	"npm-shrinkwrap.json",
+	"yarn.lock",
+	"pnpm-lock.yaml",
+	"composer.json",
+	"requirements.txt",
+	"Cargo.toml",
+}
+
+var (
+	// gitURLPattern matches URLs which are fetched with GIT: git+<scheme>://,
+	// git:// and ssh:// URLs
+	gitURLPattern = regexp.MustCompile(`(?:git\+[a-z]+://|git://|ssh://)[^\s"'<>,]+`)
+
+	// scpURLPattern matches scp-like user@host:path URLs. In text manifests
+	// they are only accepted in dependency positions, i.e. following "git+"
+	// (e.g. pip's "name @ git+git@host:path") or as quoted value, since
+	// e-mail addresses followed by a colon look alike.
+	scpURLPattern        = regexp.MustCompile(`^[\w.-]+@[\w-]+(?:\.[\w-]+)+:[\w.~-][\w./~-]*$`)
+	dependencySCPPattern = regexp.MustCompile(`(?:git\+|["'])([\w.-]+@[\w-]+(?:\.[\w-]+)+:[\w.~-][\w./~-]*)`)
+
+	gemfileGitPattern    = regexp.MustCompile(`(?:^|[\s,(])(?::git\s*=>|git:|git)\s*\(?\s*["']([^"']+)["']`)
+	gemfileGitHubPattern = regexp.MustCompile(`(?:^|[\s,(])(?::github\s*=>|github:|github)\s*\(?\s*["']([^"']+)["']`)
+	gemfileLockPattern   = regexp.MustCompile(`^\s+remote:\s*(\S+)`)
+	pnpmRepoPattern      = regexp.MustCompile(`repo:\s*["']?([^\s"',}]+)`)
+	cargoGitPattern      = regexp.MustCompile(`\bgit\s*=\s*["']([^"']+)["']`)
+	npmShorthandPattern  = regexp.MustCompile(`^[\w.-]+/[\w.-]+(?:#.*)?$`)
+	goModRequirePattern  = regexp.MustCompile(`^\s*(?:require\s+|replace\s+.*=>\s*)?([\w.-]+\.[\w-]+(?:/[\w.~-]+)+)\s+v\S+`)
+)
+
+// npmHostShorthands are the hosted Git shorthands of npm, e.g. "github:org/repo"
+var npmHostShorthands = map[string]string{
+	"github":    "github.com",
+	"gitlab":    "gitlab.com",
+	"bitbucket": "bitbucket.org",
+	"gist":      "gist.github.com",
+}
+
+// ManifestURL is a Git URL referenced by a dependency manifest
+type ManifestURL struct {
+	// URL is the host and path of the repository in the format of
+	// normalizeHostPath, it never contains credentials
+	URL string
+
+	// File is the name of the manifest
+	File string
+
+	// SSH reports whether the repository is fetched via SSH
+	SSH bool
+
+	// GoModule reports whether the URL is the path of a Go module
+	GoModule bool
+}
+
+// ScanManifests extracts the Git URLs referenced by the dependency manifests
+// in the given directory
+func ScanManifests(workingDir string) ([]ManifestURL, error) {
+	var urls []ManifestURL
+	seen := map[string]bool{}
+	appendURL := func(manifestURL ManifestURL) {
+		if seen[manifestURL.File+" "+manifestURL.URL] {
+			return
+		}
+		seen[manifestURL.File+" "+manifestURL.URL] = true
+		urls = append(urls, manifestURL)
+	}
+	add := func(file string, raw string) {
+		manifestURL, ok := newManifestURL(file, raw)
+		if ok {
+			appendURL(manifestURL)
+		}
+	}
+
+	for _, file := range ManifestFiles {
+		content, err := ioutil.ReadFile(filepath.Join(workingDir, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch file {
+		case "Gemfile":
+			for _, match := range gemfileGitPattern.FindAllStringSubmatch(string(content), -1) {
+				add(file, match[1])
+			}
+			for _, match := range gemfileGitHubPattern.FindAllStringSubmatch(string(content), -1) {
+				add(file, "https://github.com/"+match[1])
+			}
+
+		case "Gemfile.lock":
+			scanner := bufio.NewScanner(strings.NewReader(string(content)))
+			section := ""
+			for scanner.Scan() {
+				line := scanner.Text()
+				if line != "" && !strings.HasPrefix(line, " ") {
+					section = line
+					continue
+				}
+				if match := gemfileLockPattern.FindStringSubmatch(line); match != nil && section == "GIT" {
+					add(file, match[1])
+				}
+			}
+
+		case "go.mod":
+			for _, line := range strings.Split(string(content), "\n") {
+				if match := goModRequirePattern.FindStringSubmatch(line); match != nil {
+					appendURL(ManifestURL{URL: normalizeHostPath(match[1]), File: file, GoModule: true})
+				}
+			}
+
+		case "package.json":
+			dependencies, err := packageJSONDependencies(content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+			}
+			for _, dependency := range dependencies {
+				add(file, npmGitURL(dependency))
+			}
+
+		case "composer.json":
+			repositories, err := composerRepositories(content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+			}
+			for _, repository := range repositories {
+				add(file, repository)
+			}
+
+		case "pnpm-lock.yaml":
+			for _, line := range manifestLines(file, content) {
+				for _, match := range pnpmRepoPattern.FindAllStringSubmatch(line, -1) {
+					add(file, match[1])
+				}
+				for _, gitURL := range textGitURLs(line) {
+					add(file, gitURL)
+				}
+			}
+
+		case "Cargo.toml":
+			for _, match := range cargoGitPattern.FindAllStringSubmatch(string(content), -1) {
+				add(file, match[1])
+			}
+
+		default:
+			for _, line := range manifestLines(file, content) {
+				for _, gitURL := range textGitURLs(line) {
+					add(file, gitURL)
+				}
+			}
+		}
+	}
+
+	return urls, nil
+}
+
+// manifestLines returns the lines of a text manifest without comments, i.e.
+// lines starting with "#" and, in requirements.txt, text following " #"
+func manifestLines(file string, content []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if file == "requirements.txt" {
+			line, _, _ = strings.Cut(line, " #")
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// textGitURLs returns the Git URLs in a line of a text manifest
+func textGitURLs(line string) []string {
+	gitURLs := gitURLPattern.FindAllString(line, -1)
+	for _, match := range dependencySCPPattern.FindAllStringSubmatch(line, -1) {
+		gitURLs = append(gitURLs, match[1])
+	}
+
+	return gitURLs
+}
+
+// newManifestURL normalizes a Git URL found in a manifest, dropping revisions
+// such as "#v1.0" or pip's "@v1.0"
+func newManifestURL(file string, raw string) (ManifestURL, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ManifestURL{}, false
+	}
+
+	raw, _, _ = strings.Cut(raw, "#")
+	raw = strings.TrimPrefix(raw, "git+")
+
+	ssh := strings.HasPrefix(raw, "ssh://")
+	scheme, rest, found := strings.Cut(raw, "://")
+	if !found {
+		// scp-like syntax, e.g. git@github.com:org/repo.git
+		userHost, repoPath, ok := strings.Cut(raw, ":")
+		if !ok || !strings.Contains(userHost, "@") {
+			return ManifestURL{}, false
+		}
+		ssh = true
+		rest = userHost + "/" + repoPath
+	} else if scheme != "https" && scheme != "http" && scheme != "ssh" && scheme != "git" {
+		return ManifestURL{}, false
+	}
+
+	// pip and pnpm append the revision to the path with "@"
+	if slash := strings.Index(rest, "/"); slash >= 0 {
+		if at := strings.Index(rest[slash:], "@"); at >= 0 {
+			rest = rest[:slash+at]
+		}
+	}
+
+	normalized := normalizeHostPath(rest)
+	if !strings.Contains(normalized, "/") {
+		return ManifestURL{}, false
+	}
+
+	return ManifestURL{URL: normalized, File: file, SSH: ssh}, true
+}
+
+// packageJSONDependencies returns the version specifiers of all dependencies
+// of a package.json
+func packageJSONDependencies(content []byte) ([]string, error) {
+	var manifest map[string]json.RawMessage
+	err := json.Unmarshal(content, &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var specifiers []string
+	for _, field := range []string{"dependencies", "devDependencies", "optionalDependencies", "peerDependencies"} {
+		raw, ok := manifest[field]
+		if !ok {
+			continue
+		}
+
+		var dependencies map[string]string
+		err = json.Unmarshal(raw, &dependencies)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+
+		names := make([]string, 0, len(dependencies))
+		for name := range dependencies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			specifiers = append(specifiers, dependencies[name])
+		}
+	}
+
+	return specifiers, nil
+}
+
+// npmLocalPrefixes are the prefixes of npm version specifiers referring to
+// local directories
+var npmLocalPrefixes = []string{"./", "../", "/", "~/", "file:", "link:"}
+
+// npmGitURL turns an npm version specifier into a Git URL. Specifiers which
+// do not refer to a Git repository, e.g. "^1.0.0" or "../lib", yield an empty
+// string.
+func npmGitURL(specifier string) string {
+	for _, prefix := range npmLocalPrefixes {
+		if strings.HasPrefix(specifier, prefix) {
+			return ""
+		}
+	}
+
+	if prefix, repository, found := strings.Cut(specifier, ":"); found {
+		if host, ok := npmHostShorthands[prefix]; ok {
+			return "https://" + host + "/" + repository
+		}
+	}
+
+	if npmShorthandPattern.MatchString(specifier) {
+		return "https://github.com/" + specifier
+	}
+
+	repository, _, _ := strings.Cut(specifier, "#")
+	if (strings.HasPrefix(repository, "https://") || strings.HasPrefix(repository, "http://")) && strings.HasSuffix(repository, ".git") {
+		return specifier
+	}
+
+	if gitURLPattern.MatchString(specifier) || scpURLPattern.MatchString(specifier) {
+		return specifier
+	}
+
+	return ""
+}
+
+// composerRepositories returns the URLs of the VCS repositories of a
+// composer.json
+func composerRepositories(content []byte) ([]string, error) {
+	var manifest struct {
+		Repositories json.RawMessage `json:"repositories"`
+	}
+	err := json.Unmarshal(content, &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	type repository struct {
+		Type string `json:"type"`
+		URL  string `json:"url"`
+	}
+
+	// repositories are either a list or an object keyed by name
+	var repositories []repository
+	if len(manifest.Repositories) > 0 && manifest.Repositories[0] == '{' {
+		var named map[string]repository
+		err = json.Unmarshal(manifest.Repositories, &named)
+		if err != nil {
+			return nil, fmt.Errorf("repositories: %w", err)
+		}
+
+		names := make([]string, 0, len(named))
+		for name := range named {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			repositories = append(repositories, named[name])
+		}
+	} else if len(manifest.Repositories) > 0 {
+		// entries like {"packagist.org": false} are not repositories
+		var entries []json.RawMessage
+		err = json.Unmarshal(manifest.Repositories, &entries)
+		if err != nil {
+			return nil, fmt.Errorf("repositories: %w", err)
+		}
+
+		for _, entry := range entries {
+			var r repository
+			if json.Unmarshal(entry, &r) == nil {
+				repositories = append(repositories, r)
+			}
+		}
+	}
+
+	var urls []string
+	for _, r := range repositories {
+		switch r.Type {
+		case "vcs", "git", "github", "gitlab", "bitbucket":
+			urls = append(urls, r.URL)
+		}
+	}
+
+	return urls, nil
+}
+
+// matchGoPatterns reports whether a module path matches one of the comma
+// separated glob patterns of GOPRIVATE, GONOPROXY or GONOSUMDB. Like Go, a
+// pattern matches a prefix of the path segments.
+func matchGoPatterns(patterns string, module string) bool {
+	segments := strings.Split(module, "/")
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSuffix(strings.TrimSpace(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+
+		count := strings.Count(pattern, "/") + 1
+		if count > len(segments) {
+			continue
+		}
+
+		matched, err := path.Match(pattern, strings.Join(segments[:count], "/"))
+		if err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckManifests prints which Git URLs referenced by the dependency manifests
+// in the working directory are covered by a credential. URLs which are not
+// covered but are private, i.e. fetched via SSH, on a host with credentials
+// or Go modules matching GOPRIVATE / GONOPROXY, fail the build in strict mode.
+func (e BuildEnvironment) CheckManifests(strict bool) error {
+	urls, err := ScanManifests(e.Context.WorkingDir)
+	if err != nil {
+		return err
+	}
+
+	if len(urls) == 0 {
+		return nil
+	}
+
+	covered := CoveredHosts(e.BuildPackYML.Credentials)
+	hosts := map[string]bool{}
+	for _, host := range covered {
+		name, _, _ := strings.Cut(host, "/")
+		hosts[name] = true
+	}
+	goPrivate := os.Getenv("GOPRIVATE") + "," + os.Getenv("GONOPROXY")
+
+	e.Logger.Process("Checking Git URLs of dependency manifests")
+	e.Logger.Subprocess("%-50s %-20s %s", "URL", "Manifest", "Credential")
+
+	var uncovered []string
+	for _, manifestURL := range urls {
+		host, _, _ := strings.Cut(manifestURL.URL, "/")
+		private := manifestURL.SSH || hosts[host]
+
+		if manifestURL.GoModule {
+			// public modules are downloaded from the module proxy rather
+			// than with GIT
+			if !hosts[host] && !matchGoPatterns(goPrivate, manifestURL.URL) {
+				continue
+			}
+			private = true
+		}
+
+		status := "covered"
+		if !hostCovered(covered, manifestURL.URL) {
+			status = "not covered"
+			if private {
+				status = "not covered (private)"
+				uncovered = append(uncovered, manifestURL.URL)
+			}
+		}
+
+		e.Logger.Subprocess("%-50s %-20s %s", manifestURL.URL, manifestURL.File, status)
+	}
+	e.Logger.Break()
+
+	if len(uncovered) == 0 {
+		return nil
+	}
+
+	if strict {
+		return fmt.Errorf("private Git URLs of dependency manifests are not covered by any credential: %s", strings.Join(uncovered, ", "))
+	}
+
+	e.Logger.Subprocess("Warning: private Git URLs of dependency manifests are not covered by any credential: %s", strings.Join(uncovered, ", "))
+	e.Logger.Break()
+
+	return nil
+}
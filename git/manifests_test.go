@@ -0,0 +1,193 @@
+package git_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testManifests(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = ioutil.TempDir("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	writeManifest := func(name string, content string) {
+		Expect(ioutil.WriteFile(filepath.Join(workingDir, name), []byte(content), 0644)).To(Succeed())
+	}
+
+	context("ScanManifests", func() {
+		it("extracts and normalizes Git URLs", func() {
+			writeManifest("Gemfile", `source "https://rubygems.org"
+gem "rails"
+gem "private", git: "https://token@github.com/acme/private.git", branch: "main"
+gem "other", :github => "acme/other"
+git "git@gitlab.com:group/gems.git" do
+  gem "gem-a"
+end
+`)
+			writeManifest("Gemfile.lock", `GIT
+  remote: https://github.com/acme/private.git
+  revision: abc
+  specs:
+    private (1.0)
+
+GEM
+  remote: https://rubygems.org/
+`)
+			writeManifest("go.mod", `module example.com/app
+
+go 1.18
+
+require (
+	github.com/acme/lib v1.2.3
+	golang.org/x/text v0.3.7 // indirect
+)
+`)
+			writeManifest("package.json", `{
+  "name": "app",
+  "homepage": "https://example.com",
+  "dependencies": {
+    "express": "^4.0.0",
+    "lib-a": "github:acme/lib-a#v1",
+    "lib-b": "acme/lib-b",
+    "lib-c": "git+ssh://git@bitbucket.org/team/lib-c.git#semver:^1.0",
+    "lib-e": "../lib-e",
+    "lib-f": "./lib-f",
+    "lib-g": "file:../lib-g",
+    "lib-h": "link:../lib-h",
+    "lib-i": "/opt/lib-i",
+    "lib-j": "~/lib-j"
+  },
+  "devDependencies": {
+    "lib-d": "https://git.example.com/lib-d.git"
+  }
+}`)
+			writeManifest("yarn.lock", `# yarn lockfile v1, questions to dev@corp.example.com:support
+"lib-c@git+ssh://git@bitbucket.org/team/lib-c.git":
+  resolved "git+ssh://git@bitbucket.org/team/lib-c.git#0123"
+express@^4.0.0:
+  resolved "https://registry.yarnpkg.com/express/-/express-4.0.0.tgz"
+`)
+			writeManifest("composer.json", `{
+  "repositories": [
+    {"type": "vcs", "url": "git@github.com:acme/php-lib.git"},
+    {"type": "composer", "url": "https://packages.example.com"},
+    {"packagist.org": false}
+  ]
+}`)
+			writeManifest("requirements.txt", `# contact dev@corp.example.com:support
+requests==2.0  # see admin@corp.example.com:docs
+git+https://github.com/acme/py-lib.git@v1.0#egg=py-lib
+-e git+git@gitlab.com:group/py-editable.git#egg=py-editable
+py-pkg @ git+git@gitlab.com:group/py-pkg.git@v1.0
+`)
+			writeManifest("Cargo.toml", `[dependencies]
+serde = "1.0"
+rs-lib = { git = "https://github.com/acme/rs-lib", branch = "main" }
+`)
+
+			urls, err := git.ScanManifests(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(urls).To(Equal([]git.ManifestURL{
+				{URL: "github.com/acme/private", File: "Gemfile"},
+				{URL: "gitlab.com/group/gems", File: "Gemfile", SSH: true},
+				{URL: "github.com/acme/other", File: "Gemfile"},
+				{URL: "github.com/acme/private", File: "Gemfile.lock"},
+				{URL: "github.com/acme/lib", File: "go.mod", GoModule: true},
+				{URL: "golang.org/x/text", File: "go.mod", GoModule: true},
+				{URL: "github.com/acme/lib-a", File: "package.json"},
+				{URL: "github.com/acme/lib-b", File: "package.json"},
+				{URL: "bitbucket.org/team/lib-c", File: "package.json", SSH: true},
+				{URL: "git.example.com/lib-d", File: "package.json"},
+				{URL: "bitbucket.org/team/lib-c", File: "yarn.lock", SSH: true},
+				{URL: "github.com/acme/php-lib", File: "composer.json", SSH: true},
+				{URL: "github.com/acme/py-lib", File: "requirements.txt"},
+				{URL: "gitlab.com/group/py-editable", File: "requirements.txt", SSH: true},
+				{URL: "gitlab.com/group/py-pkg", File: "requirements.txt", SSH: true},
+				{URL: "github.com/acme/rs-lib", File: "Cargo.toml"},
+			}))
+		})
+
+		it("returns an error for an invalid package.json", func() {
+			writeManifest("package.json", `{"dependencies": [`)
+
+			_, err := git.ScanManifests(workingDir)
+			Expect(err).To(MatchError(ContainSubstring("failed to parse package.json")))
+		})
+	})
+
+	context("CheckManifests", func() {
+		var (
+			buffer *bytes.Buffer
+			env    git.BuildEnvironment
+		)
+
+		it.Before(func() {
+			buffer = bytes.NewBuffer(nil)
+			env = git.BuildEnvironment{
+				Context: packit.BuildContext{WorkingDir: workingDir},
+				Logger:  scribe.NewLogger(buffer),
+				BuildPackYML: git.BuildPackYML{
+					Credentials: []git.GitCredential{
+						{Protocol: "https", Host: "github.com", Path: "/acme", Username: "user", Password: "token"},
+					},
+				},
+			}
+
+			writeManifest("package.json", `{"dependencies": {
+  "lib-a": "github:acme/lib-a",
+  "lib-b": "github:other/lib-b",
+  "lib-c": "git+ssh://git@bitbucket.org/team/lib-c.git",
+  "lib-d": "git+https://git.example.com/public/lib-d.git"
+}}`)
+			writeManifest("go.mod", "module example.com/app\n\nrequire golang.org/x/text v0.3.7\n")
+		})
+
+		it.After(func() {
+			os.Unsetenv("GOPRIVATE")
+		})
+
+		it("prints which URLs are covered", func() {
+			Expect(env.CheckManifests(false)).To(Succeed())
+			Expect(buffer.String()).To(MatchRegexp(`github.com/acme/lib-a\s+package.json\s+covered`))
+			Expect(buffer.String()).To(MatchRegexp(`github.com/other/lib-b\s+package.json\s+not covered \(private\)`))
+			Expect(buffer.String()).To(MatchRegexp(`bitbucket.org/team/lib-c\s+package.json\s+not covered \(private\)`))
+			Expect(buffer.String()).To(MatchRegexp(`git.example.com/public/lib-d\s+package.json\s+not covered\n`))
+			Expect(buffer.String()).NotTo(ContainSubstring("golang.org/x/text"))
+			Expect(buffer.String()).To(ContainSubstring("Warning: private Git URLs of dependency manifests are not covered by any credential: github.com/other/lib-b, bitbucket.org/team/lib-c"))
+		})
+
+		it("reports Go modules matching GOPRIVATE", func() {
+			os.Setenv("GOPRIVATE", "golang.org/x")
+
+			Expect(env.CheckManifests(false)).To(Succeed())
+			Expect(buffer.String()).To(MatchRegexp(`golang.org/x/text\s+go.mod\s+not covered \(private\)`))
+		})
+
+		it("fails for uncovered private URLs in strict mode", func() {
+			err := env.CheckManifests(true)
+			Expect(err).To(MatchError("private Git URLs of dependency manifests are not covered by any credential: github.com/other/lib-b, bitbucket.org/team/lib-c"))
+		})
+	})
+}
@@ -0,0 +1,127 @@
+package git
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Mirror redirects all repositories below an upstream URL prefix to a mirror
+type Mirror struct {
+	// Upstream is the HTTPS URL prefix of the mirrored repositories, e.g.
+	// https://github.com/. The corresponding SSH URLs are redirected as well.
+	Upstream string `yaml:"upstream" json:"upstream"`
+
+	// URL is the base URL of the mirror, e.g. https://gitea.example.com/github/
+	URL string `yaml:"url" json:"url"`
+
+	// Username and Password are the credentials for the mirror. They may be
+	// omitted if a credential for the mirror is specified separately.
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+}
+
+// rewrites returns the mirror URL and the URL prefixes rewritten to it
+func (m Mirror) rewrites() (string, []string, error) {
+	upstream, err := url.Parse(m.Upstream)
+	if err != nil || (upstream.Scheme != "https" && upstream.Scheme != "http") || upstream.Host == "" {
+		return "", nil, fmt.Errorf("invalid upstream %q of mirror: an HTTPS URL such as https://github.com/ is required", m.Upstream)
+	}
+
+	mirror, err := url.Parse(m.URL)
+	if err != nil || mirror.Scheme == "" || mirror.Host == "" {
+		return "", nil, fmt.Errorf("invalid URL of the mirror for %s: a protocol and host are required", m.Upstream)
+	}
+
+	upstreamPath := upstream.EscapedPath()
+	if !strings.HasSuffix(upstreamPath, "/") {
+		upstreamPath += "/"
+	}
+
+	mirrorURL := strings.TrimSuffix(m.URL, "/") + "/"
+
+	hostName := upstream.Hostname()
+	return mirrorURL, []string{
+		upstream.Scheme + "://" + upstream.Host + upstreamPath,
+		"git@" + hostName + ":" + strings.TrimPrefix(upstreamPath, "/"),
+		"ssh://git@" + hostName + upstreamPath,
+	}, nil
+}
+
+// MirrorCredentials returns a credential for each mirror which specifies a
+// username and password
+func MirrorCredentials(mirrors []Mirror) ([]GitCredential, error) {
+	var credentials []GitCredential
+	for _, mirror := range mirrors {
+		if mirror.Username == "" && mirror.Password == "" {
+			continue
+		}
+
+		mirrorURL, _, err := mirror.rewrites()
+		if err != nil {
+			return nil, err
+		}
+
+		parsed, err := url.Parse(mirrorURL)
+		if err != nil {
+			return nil, err
+		}
+
+		credentials = append(credentials, GitCredential{
+			Protocol: parsed.Scheme,
+			Host:     parsed.Host,
+			Path:     parsed.EscapedPath(),
+			Username: mirror.Username,
+			Password: mirror.Password,
+		})
+	}
+
+	return credentials, nil
+}
+
+// mirroredPrefixes returns the URL prefixes which are rewritten to mirrors
+func (e BuildEnvironment) mirroredPrefixes() map[string]bool {
+	prefixes := map[string]bool{}
+	for _, mirror := range e.BuildPackYML.Mirrors {
+		_, rewrites, err := mirror.rewrites()
+		if err != nil {
+			continue
+		}
+
+		for _, prefix := range rewrites {
+			prefixes[prefix] = true
+		}
+	}
+
+	return prefixes
+}
+
+// ConfigureMirrors directs GIT to fetch the repositories below the upstream
+// URL prefix of each mirror, in both HTTPS and SSH form, from the mirror via
+// url.<mirror>.insteadOf
+func (e BuildEnvironment) ConfigureMirrors() error {
+	e.Logger.Process("Configuring git to use mirrors")
+
+	for _, mirror := range e.BuildPackYML.Mirrors {
+		mirrorURL, rewrites, err := mirror.rewrites()
+		if err != nil {
+			return err
+		}
+
+		for _, prefix := range rewrites {
+			err = e.RunGitCommand([]string{
+				"git",
+				"config",
+				"--global",
+				"--add",
+				"url." + mirrorURL + ".insteadOf",
+				prefix,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package git_test
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testMirror(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		env git.BuildEnvironment
+	)
+
+	gitConfigAll := func(key string) []string {
+		output, err := exec.Command("git", "config", "--global", "--get-all", key).Output()
+		if err != nil {
+			return nil
+		}
+		return strings.Split(strings.TrimSpace(string(output)), "\n")
+	}
+
+	it.Before(func() {
+		env = git.BuildEnvironment{
+			Logger: scribe.NewLogger(ioutil.Discard),
+			BuildPackYML: git.BuildPackYML{
+				Mirrors: []git.Mirror{
+					{Upstream: "https://github.com/", URL: "https://gitea.example.com/github", Username: "mirror", Password: "mirror-token"},
+					{Upstream: "https://gitlab.com/group", URL: "https://gitea.example.com/gitlab/"},
+				},
+				Credentials: []git.GitCredential{
+					{Protocol: "https", Host: "github.com", Path: "/", Username: "user", Password: "token", InsteadOf: []string{"ssh://git@github.com/"}},
+					{Protocol: "https", Host: "gitlab.com", Path: "/", Username: "user", Password: "token"},
+				},
+			},
+		}
+	})
+
+	it.After(func() {
+		for _, section := range []string{
+			"url.https://gitea.example.com/github/",
+			"url.https://gitea.example.com/gitlab/",
+			"url.https://github.com/",
+			"url.https://gitlab.com/",
+			"credential.https://github.com/",
+			"credential.https://gitlab.com/",
+		} {
+			_ = exec.Command("git", "config", "--global", "--remove-section", section).Run()
+		}
+	})
+
+	it("rewrites HTTPS and SSH URLs of the upstream to the mirror", func() {
+		Expect(env.ConfigureMirrors()).To(Succeed())
+
+		Expect(gitConfigAll("url.https://gitea.example.com/github/.insteadof")).To(Equal([]string{
+			"https://github.com/",
+			"git@github.com:",
+			"ssh://git@github.com/",
+		}))
+		Expect(gitConfigAll("url.https://gitea.example.com/gitlab/.insteadof")).To(Equal([]string{
+			"https://gitlab.com/group/",
+			"git@gitlab.com:group/",
+			"ssh://git@gitlab.com/group/",
+		}))
+	})
+
+	it("does not rewrite mirrored prefixes to credentials", func() {
+		Expect(env.Configure()).To(Succeed())
+
+		Expect(gitConfigAll("url.https://github.com/.insteadof")).To(BeEmpty())
+		Expect(gitConfigAll("url.https://gitlab.com/.insteadof")).To(Equal([]string{"git@gitlab.com:"}))
+	})
+
+	it("returns credentials for mirrors", func() {
+		credentials, err := git.MirrorCredentials(env.BuildPackYML.Mirrors)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credentials).To(Equal([]git.GitCredential{
+			{Protocol: "https", Host: "gitea.example.com", Path: "/github/", Username: "mirror", Password: "mirror-token"},
+		}))
+	})
+
+	it("rejects invalid upstreams and mirror URLs", func() {
+		env.BuildPackYML.Mirrors = []git.Mirror{{Upstream: "git@github.com:", URL: "https://gitea.example.com/github/"}}
+		Expect(env.ConfigureMirrors()).To(MatchError(`invalid upstream "git@github.com:" of mirror: an HTTPS URL such as https://github.com/ is required`))
+
+		env.BuildPackYML.Mirrors = []git.Mirror{{Upstream: "https://github.com/", URL: "gitea.example.com"}}
+		Expect(env.ConfigureMirrors()).To(MatchError("invalid URL of the mirror for https://github.com/: a protocol and host are required"))
+	})
+}
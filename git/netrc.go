@@ -0,0 +1,97 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NetrcFileName is the name of the .netrc file written into the
+// gitcredentials layer
+const NetrcFileName = ".netrc"
+
+// NetrcEnabled reports whether a .netrc file should be generated, either
+// because "netrc" is set in the buildpack.yml or because the environment
+// variable GIT_CREDENTIALS_NETRC is set to a true value
+func (e BuildEnvironment) NetrcEnabled() (bool, error) {
+	enabled, err := lookupEnvBool("GIT_CREDENTIALS_NETRC")
+	if err != nil {
+		return false, err
+	}
+
+	return enabled || e.BuildPackYML.Netrc, nil
+}
+
+// WriteNetrc writes a .netrc file containing all HTTPs credentials into the
+// given layer directory and returns the path of the file
+func (e BuildEnvironment) WriteNetrc(layerPath string) (string, error) {
+	e.Logger.Process("Writing .netrc for HTTPs credentials")
+
+	var bf strings.Builder
+	machines := map[string]bool{}
+	for _, credential := range e.BuildPackYML.Credentials {
+		machine, ok := netrcMachine(credential)
+		if !ok {
+			continue
+		}
+
+		if machines[machine] {
+			e.Logger.Subprocess("Skipping additional credentials for %s: .netrc supports one entry per host", machine)
+			continue
+		}
+		machines[machine] = true
+
+		bf.WriteString(fmt.Sprintf("machine %s login %s password %s\n", machine, credential.Username, credential.Password))
+		e.Logger.Subprocess("Added entry for %s", machine)
+	}
+
+	err := os.MkdirAll(layerPath, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(layerPath, NetrcFileName)
+	err = ioutil.WriteFile(path, []byte(bf.String()), 0600)
+	if err != nil {
+		return "", err
+	}
+
+	// WriteFile does not change the mode of an already existing file
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	e.Logger.Break()
+	return path, nil
+}
+
+// netrcMachine returns the host name a credential applies to if it is an
+// HTTPs credential which can be expressed in a .netrc file
+func netrcMachine(credential GitCredential) (string, bool) {
+	// .netrc only supports basic authentication
+	if len(credential.Username) == 0 || len(credential.Password) == 0 || credential.IsBearer() || credential.IsCookie() {
+		return "", false
+	}
+
+	protocol := credential.Protocol
+	host := credential.Host
+	if credential.URL != "" {
+		credentialURL, err := url.Parse(credential.URL)
+		if err != nil {
+			return "", false
+		}
+		protocol = credentialURL.Scheme
+		host = credentialURL.Host
+	}
+
+	if protocol != "https" || host == "" {
+		return "", false
+	}
+
+	// .netrc entries match on the host name only
+	return (&url.URL{Host: host}).Hostname(), true
+}
@@ -0,0 +1,100 @@
+package git_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testNetrc(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		layerDir string
+		env      git.BuildEnvironment
+	)
+
+	it.Before(func() {
+		var err error
+		layerDir, err = ioutil.TempDir("", "layer")
+		Expect(err).NotTo(HaveOccurred())
+
+		env = git.BuildEnvironment{
+			Logger: scribe.NewLogger(os.Stdout),
+			BuildPackYML: git.BuildPackYML{
+				Credentials: []git.GitCredential{
+					{Protocol: "https", Host: "github.com", Path: "/", Username: "user", Password: "token"},
+					{Protocol: "https", Host: "github.com", Path: "/other", Username: "other", Password: "other-token"},
+					{Protocol: "https", Host: "git.example.com:8443", Path: "/", Username: "user2", Password: "pass2"},
+					{Protocol: "http", Host: "insecure.example.com", Path: "/", Username: "user3", Password: "pass3"},
+					{Protocol: "https", Host: "ignored.example.com", URL: "https://example.org", Username: "user4", Password: "pass4"},
+				},
+			},
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(layerDir)).To(Succeed())
+	})
+
+	context("NetrcEnabled", func() {
+		it.After(func() {
+			os.Unsetenv("GIT_CREDENTIALS_NETRC")
+		})
+
+		it("is disabled by default", func() {
+			enabled, err := env.NetrcEnabled()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(enabled).To(BeFalse())
+		})
+
+		it("is enabled by the buildpack.yml", func() {
+			env.BuildPackYML.Netrc = true
+
+			enabled, err := env.NetrcEnabled()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(enabled).To(BeTrue())
+		})
+
+		it("is enabled by the environment", func() {
+			os.Setenv("GIT_CREDENTIALS_NETRC", "true")
+
+			enabled, err := env.NetrcEnabled()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(enabled).To(BeTrue())
+		})
+
+		it("returns an error for invalid values", func() {
+			os.Setenv("GIT_CREDENTIALS_NETRC", "maybe")
+
+			_, err := env.NetrcEnabled()
+			Expect(err).To(MatchError(`invalid value for GIT_CREDENTIALS_NETRC: "maybe" is not a boolean`))
+		})
+	})
+
+	context("WriteNetrc", func() {
+		it("writes one entry per HTTPs host with mode 0600", func() {
+			path, err := env.WriteNetrc(layerDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(path).To(Equal(filepath.Join(layerDir, ".netrc")))
+
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			content, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal(`machine github.com login user password token
+machine git.example.com login user2 password pass2
+machine example.org login user4 password pass4
+`))
+		})
+	})
+}
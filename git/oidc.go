@@ -0,0 +1,153 @@
+package git
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Token types and grant type defined by RFC 8693 (OAuth 2.0 Token Exchange)
+const (
+	TokenExchangeGrantType   = "urn:ietf:params:oauth:grant-type:token-exchange"
+	IDTokenType              = "urn:ietf:params:oauth:token-type:id_token"
+	AccessTokenType          = "urn:ietf:params:oauth:token-type:access_token"
+	DefaultOIDCTokenUsername = "oauth2"
+)
+
+// OIDCExchange configures a credential whose password is an access token
+// obtained at build time by exchanging an OIDC ID token of the CI system
+type OIDCExchange struct {
+	TokenURL    string `yaml:"token_url" json:"token_url"`
+	IDTokenFile string `yaml:"id_token_file" json:"id_token_file"`
+	IDTokenEnv  string `yaml:"id_token_env" json:"id_token_env"`
+	Audience    string `yaml:"audience" json:"audience"`
+	Scope       string `yaml:"scope" json:"scope"`
+	Username    string `yaml:"username" json:"username"`
+}
+
+// readOIDCExchangeSource returns an OIDC exchange credential configured by the
+// environment variables GIT_CREDENTIALS_OIDC_TOKEN_URL,
+// GIT_CREDENTIALS_OIDC_HOST, GIT_CREDENTIALS_OIDC_ID_TOKEN_FILE,
+// GIT_CREDENTIALS_OIDC_ID_TOKEN_ENV, GIT_CREDENTIALS_OIDC_AUDIENCE,
+// GIT_CREDENTIALS_OIDC_SCOPE and GIT_CREDENTIALS_OIDC_USERNAME
+func readOIDCExchangeSource() ([]GitCredential, error) {
+	gitTokenURL, tokenURLExists := os.LookupEnv("GIT_CREDENTIALS_OIDC_TOKEN_URL")
+	if !tokenURLExists || len(gitTokenURL) == 0 {
+		return nil, nil
+	}
+
+	host := os.Getenv("GIT_CREDENTIALS_OIDC_HOST")
+	if host == "" {
+		return nil, errors.New("GIT_CREDENTIALS_OIDC_TOKEN_URL requires GIT_CREDENTIALS_OIDC_HOST")
+	}
+
+	exchange := OIDCExchange{
+		TokenURL:    gitTokenURL,
+		IDTokenFile: os.Getenv("GIT_CREDENTIALS_OIDC_ID_TOKEN_FILE"),
+		IDTokenEnv:  os.Getenv("GIT_CREDENTIALS_OIDC_ID_TOKEN_ENV"),
+		Audience:    os.Getenv("GIT_CREDENTIALS_OIDC_AUDIENCE"),
+		Scope:       os.Getenv("GIT_CREDENTIALS_OIDC_SCOPE"),
+		Username:    os.Getenv("GIT_CREDENTIALS_OIDC_USERNAME"),
+	}
+
+	return []GitCredential{
+		{
+			Protocol:     "https",
+			Host:         host,
+			Path:         "/",
+			OIDCExchange: &exchange,
+		},
+	}, nil
+}
+
+// idToken reads the ID token from the configured file or environment variable
+func (o OIDCExchange) idToken() (string, error) {
+	if o.IDTokenFile != "" {
+		content, err := ioutil.ReadFile(o.IDTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read OIDC ID token: %w", err)
+		}
+
+		token := strings.TrimSpace(string(content))
+		if token == "" {
+			return "", fmt.Errorf("OIDC ID token file %s is empty", o.IDTokenFile)
+		}
+		return token, nil
+	}
+
+	if o.IDTokenEnv != "" {
+		token := strings.TrimSpace(os.Getenv(o.IDTokenEnv))
+		if token == "" {
+			return "", fmt.Errorf("OIDC ID token environment variable %s is not set", o.IDTokenEnv)
+		}
+		return token, nil
+	}
+
+	return "", errors.New("OIDC exchange requires either id_token_file or id_token_env")
+}
+
+// ExchangeOIDCToken exchanges the OIDC ID token for an access token at the
+// configured RFC 8693 token exchange endpoint
+func ExchangeOIDCToken(exchange OIDCExchange, httpClient *http.Client) (string, error) {
+	if exchange.TokenURL == "" {
+		return "", errors.New("OIDC exchange requires a token_url")
+	}
+
+	idToken, err := exchange.idToken()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":           {TokenExchangeGrantType},
+		"subject_token":        {idToken},
+		"subject_token_type":   {IDTokenType},
+		"requested_token_type": {AccessTokenType},
+	}
+	if exchange.Audience != "" {
+		form.Set("audience", exchange.Audience)
+	}
+	if exchange.Scope != "" {
+		form.Set("scope", exchange.Scope)
+	}
+
+	response, err := httpClient.PostForm(exchange.TokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange OIDC ID token: %s", Redact(err.Error(), idToken))
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange OIDC ID token: %w", err)
+	}
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	decodeErr := json.Unmarshal(body, &token)
+
+	if response.StatusCode != http.StatusOK {
+		if decodeErr == nil && token.Error != "" {
+			message := token.Error
+			if token.ErrorDescription != "" {
+				message += ": " + token.ErrorDescription
+			}
+			return "", fmt.Errorf("failed to exchange OIDC ID token: token endpoint returned status %d: %s", response.StatusCode, Redact(message, idToken))
+		}
+		return "", fmt.Errorf("failed to exchange OIDC ID token: token endpoint returned status %d", response.StatusCode)
+	}
+
+	if decodeErr != nil || token.AccessToken == "" {
+		return "", errors.New("failed to exchange OIDC ID token: token endpoint did not return an access token")
+	}
+
+	return token.AccessToken, nil
+}
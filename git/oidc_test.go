@@ -0,0 +1,151 @@
+package git_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testOIDC(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		server      *httptest.Server
+		form        url.Values
+		dir         string
+		idTokenFile string
+	)
+
+	it.Before(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "oidc")
+		Expect(err).NotTo(HaveOccurred())
+
+		idTokenFile = filepath.Join(dir, "token")
+		Expect(ioutil.WriteFile(idTokenFile, []byte("id-token\n"), 0600)).To(Succeed())
+
+		form = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = r.ParseForm()
+			form = r.PostForm
+
+			w.Header().Set("Content-Type", "application/json")
+			if form.Get("subject_token") != "id-token" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error": "invalid_grant", "error_description": "subject token expired"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token": "access-token", "issued_token_type": "urn:ietf:params:oauth:token-type:access_token", "token_type": "Bearer"}`))
+		}))
+	})
+
+	it.After(func() {
+		server.Close()
+		Expect(os.RemoveAll(dir)).To(Succeed())
+		os.Unsetenv("CI_ID_TOKEN")
+		os.Unsetenv("GIT_CREDENTIALS_OIDC_TOKEN_URL")
+		os.Unsetenv("GIT_CREDENTIALS_OIDC_HOST")
+		os.Unsetenv("GIT_CREDENTIALS_OIDC_ID_TOKEN_ENV")
+	})
+
+	context("ExchangeOIDCToken", func() {
+		it("posts an RFC 8693 token exchange request", func() {
+			token, err := git.ExchangeOIDCToken(git.OIDCExchange{
+				TokenURL:    server.URL,
+				IDTokenFile: idTokenFile,
+				Audience:    "git.example.com",
+				Scope:       "read_repository",
+			}, http.DefaultClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(Equal("access-token"))
+			Expect(form).To(Equal(url.Values{
+				"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+				"subject_token":        {"id-token"},
+				"subject_token_type":   {"urn:ietf:params:oauth:token-type:id_token"},
+				"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+				"audience":             {"git.example.com"},
+				"scope":                {"read_repository"},
+			}))
+		})
+
+		it("reads the ID token from an environment variable", func() {
+			os.Setenv("CI_ID_TOKEN", "id-token")
+
+			token, err := git.ExchangeOIDCToken(git.OIDCExchange{TokenURL: server.URL, IDTokenEnv: "CI_ID_TOKEN"}, http.DefaultClient)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(Equal("access-token"))
+		})
+
+		it("reports errors of the token endpoint", func() {
+			os.Setenv("CI_ID_TOKEN", "expired-token")
+
+			_, err := git.ExchangeOIDCToken(git.OIDCExchange{TokenURL: server.URL, IDTokenEnv: "CI_ID_TOKEN"}, http.DefaultClient)
+			Expect(err).To(MatchError("failed to exchange OIDC ID token: token endpoint returned status 400: invalid_grant: subject token expired"))
+		})
+
+		it("reports a missing ID token", func() {
+			_, err := git.ExchangeOIDCToken(git.OIDCExchange{TokenURL: server.URL, IDTokenEnv: "CI_ID_TOKEN"}, http.DefaultClient)
+			Expect(err).To(MatchError("OIDC ID token environment variable CI_ID_TOKEN is not set"))
+
+			_, err = git.ExchangeOIDCToken(git.OIDCExchange{TokenURL: server.URL}, http.DefaultClient)
+			Expect(err).To(MatchError("OIDC exchange requires either id_token_file or id_token_env"))
+
+			_, err = git.ExchangeOIDCToken(git.OIDCExchange{TokenURL: server.URL, IDTokenFile: filepath.Join(dir, "missing")}, http.DefaultClient)
+			Expect(err).To(MatchError(ContainSubstring("failed to read OIDC ID token")))
+		})
+	})
+
+	context("MintTokens", func() {
+		it("uses the access token as password of the configured username", func() {
+			credentials, err := git.MintTokens([]git.GitCredential{
+				{Protocol: "https", Host: "git.example.com", Path: "/", OIDCExchange: &git.OIDCExchange{TokenURL: server.URL, IDTokenFile: idTokenFile}},
+				{Protocol: "https", Host: "git.example.org", Path: "/", OIDCExchange: &git.OIDCExchange{TokenURL: server.URL, IDTokenFile: idTokenFile, Username: "ci"}},
+			}, scribe.NewLogger(ioutil.Discard))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials[0].Username).To(Equal("oauth2"))
+			Expect(credentials[0].Password).To(Equal("access-token"))
+			Expect(credentials[1].Username).To(Equal("ci"))
+		})
+
+		it("applies the defaults to a credential which only specifies the host", func() {
+			credentials, err := git.MintTokens([]git.GitCredential{
+				{Host: "git.example.com", OIDCExchange: &git.OIDCExchange{TokenURL: server.URL, IDTokenFile: idTokenFile}},
+			}, scribe.NewLogger(ioutil.Discard))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials[0].Protocol).To(Equal("https"))
+			Expect(credentials[0].Path).To(Equal("/"))
+			Expect(credentials[0].Password).To(Equal("access-token"))
+		})
+	})
+
+	context("environment variables", func() {
+		it("configures an OIDC exchange credential", func() {
+			os.Setenv("GIT_CREDENTIALS_OIDC_TOKEN_URL", server.URL)
+			os.Setenv("GIT_CREDENTIALS_OIDC_HOST", "git.example.com")
+			os.Setenv("GIT_CREDENTIALS_OIDC_ID_TOKEN_ENV", "CI_ID_TOKEN")
+
+			credentials, err := git.ReadCredentialSources("", "", git.BuildPackYML{}, scribe.NewLogger(ioutil.Discard))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(Equal([]git.GitCredential{
+				{Protocol: "https", Host: "git.example.com", Path: "/", OIDCExchange: &git.OIDCExchange{TokenURL: server.URL, IDTokenEnv: "CI_ID_TOKEN"}},
+			}))
+		})
+
+		it("requires a host", func() {
+			os.Setenv("GIT_CREDENTIALS_OIDC_TOKEN_URL", server.URL)
+
+			_, err := git.ReadCredentialSources("", "", git.BuildPackYML{}, scribe.NewLogger(ioutil.Discard))
+			Expect(err).To(MatchError("GIT_CREDENTIALS_OIDC_TOKEN_URL requires GIT_CREDENTIALS_OIDC_HOST"))
+		})
+	})
+}
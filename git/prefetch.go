@@ -0,0 +1,180 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2"
+)
+
+// PrefetchLayerName is the name of the cache layer containing bare mirrors
+// of the repositories listed in prefetch
+const PrefetchLayerName = "gitcache"
+
+// prefetchDirName returns the name of the directory of the bare mirror of a
+// repository within the cache layer
+func prefetchDirName(remote string) string {
+	sum := sha256.Sum256([]byte(remote))
+	return hex.EncodeToString(sum[:8]) + ".git"
+}
+
+// prefetchRemote normalizes a remote listed in prefetch: the ".git" suffix and
+// trailing slashes are dropped and user information is removed, so that no credentials are
+// stored in the configuration of the mirror in the cache layer. The
+// credentials are supplied by the GIT credential cache instead. It reports
+// whether user information was removed.
+func prefetchRemote(remote string) (string, bool) {
+	remote = strings.TrimSuffix(strings.TrimRight(strings.TrimSpace(remote), "/"), ".git")
+	if !strings.Contains(remote, "://") {
+		return remote, false
+	}
+
+	remoteURL, err := url.Parse(remote)
+	if err != nil || remoteURL.User == nil {
+		return remote, false
+	}
+	remoteURL.User = nil
+
+	return remoteURL.String(), true
+}
+
+// prefetchRemotes returns the normalized remotes listed in prefetch
+func (e BuildEnvironment) prefetchRemotes() []string {
+	var remotes []string
+	seen := map[string]bool{}
+	for _, remote := range e.BuildPackYML.Prefetch {
+		normalized, stripped := prefetchRemote(remote)
+		if stripped {
+			e.Logger.Subprocess("Removing user information from %s, credentials are supplied by the GIT credentials cache", Redact(remote))
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			remotes = append(remotes, normalized)
+		}
+	}
+
+	return remotes
+}
+
+// Prefetch maintains bare mirrors of the repositories listed in prefetch in
+// the given cache layer. Mirrors restored from the cache are updated with
+// "git fetch", new ones are cloned. Subsequent fetches of the repositories
+// via their URL with ".git" suffix or trailing slash are redirected to the
+// mirrors via url.file://<mirror>.insteadOf. The layer metadata records the
+// remote URL and the last fetch time of each mirror.
+func (e BuildEnvironment) Prefetch(layer packit.Layer, now time.Time) (packit.Layer, error) {
+	e.Logger.Process("Prefetching repositories")
+
+	remotes := e.prefetchRemotes()
+
+	err := os.MkdirAll(layer.Path, 0755)
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	// mirrors of repositories removed from the prefetch list are dropped from
+	// the cache
+	wanted := map[string]bool{}
+	for _, remote := range remotes {
+		wanted[prefetchDirName(remote)] = true
+	}
+
+	entries, err := ioutil.ReadDir(layer.Path)
+	if err != nil {
+		return packit.Layer{}, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".git") && !wanted[entry.Name()] {
+			e.Logger.Subprocess("Removing mirror %s", entry.Name())
+			err = os.RemoveAll(filepath.Join(layer.Path, entry.Name()))
+			if err != nil {
+				return packit.Layer{}, err
+			}
+		}
+	}
+
+	var mirrors []map[string]interface{}
+	for _, remote := range remotes {
+		dirName := prefetchDirName(remote)
+		mirrorPath := filepath.Join(layer.Path, dirName)
+
+		_, err = os.Stat(filepath.Join(mirrorPath, "HEAD"))
+		if err == nil {
+			e.Logger.Subprocess("Updating mirror of %s", Redact(remote))
+			err = e.RunGitCommand([]string{
+				"git",
+				"--git-dir",
+				mirrorPath,
+				"fetch",
+				"--prune",
+				"--quiet",
+				"origin",
+			})
+		} else {
+			e.Logger.Subprocess("Cloning mirror of %s", Redact(remote))
+			err = os.RemoveAll(mirrorPath)
+			if err != nil {
+				return packit.Layer{}, err
+			}
+
+			err = e.RunGitCommand([]string{
+				"git",
+				"clone",
+				"--mirror",
+				"--quiet",
+				remote,
+				mirrorPath,
+			})
+		}
+		if err != nil {
+			return packit.Layer{}, err
+		}
+
+		mirrors = append(mirrors, map[string]interface{}{
+			"remote":     Redact(remote),
+			"directory":  dirName,
+			"last_fetch": now.UTC().Format(time.RFC3339),
+		})
+	}
+
+	// redirect fetches only after all mirrors are up to date, otherwise
+	// mirrors would be fetched from themselves
+	// url.<base>.insteadOf matches by string prefix, the rewrites end at a
+	// path boundary so that https://host/org/lib does not capture
+	// https://host/org/lib-utils
+	for _, remote := range remotes {
+		mirrorURL := "file://" + filepath.Join(layer.Path, prefetchDirName(remote))
+		for _, rewrite := range [][2]string{
+			{mirrorURL, remote + ".git"},
+			{mirrorURL + "/", remote + "/"},
+		} {
+			err = e.RunGitCommand([]string{
+				"git",
+				"config",
+				"--global",
+				"--add",
+				"url." + rewrite[0] + ".insteadOf",
+				rewrite[1],
+			})
+			if err != nil {
+				return packit.Layer{}, err
+			}
+		}
+	}
+
+	layer.Build = true
+	layer.Cache = true
+	layer.Launch = false
+	layer.Metadata = map[string]interface{}{
+		"mirrors": mirrors,
+	}
+
+	return layer, nil
+}
@@ -0,0 +1,174 @@
+package git_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testPrefetch(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		remoteDir string
+		layersDir string
+		remote    string
+		env       git.BuildEnvironment
+	)
+
+	run := func(dir string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(output))
+		return strings.TrimSpace(string(output))
+	}
+
+	commit := func(message string) string {
+		run(remoteDir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--allow-empty", "--quiet", "-m", message)
+		return run(remoteDir, "rev-parse", "HEAD")
+	}
+
+	unsetInsteadOf := func() {
+		output, _ := exec.Command("git", "config", "--global", "--name-only", "--get-regexp", `^url\.file://.*\.insteadof$`).Output()
+		for _, key := range strings.Fields(string(output)) {
+			_ = exec.Command("git", "config", "--global", "--unset-all", key).Run()
+		}
+	}
+
+	it.Before(func() {
+		var err error
+		remoteDir, err = ioutil.TempDir("", "remote")
+		Expect(err).NotTo(HaveOccurred())
+
+		layersDir, err = ioutil.TempDir("", "layers")
+		Expect(err).NotTo(HaveOccurred())
+
+		run(remoteDir, "init", "--quiet")
+		remote = "file://" + remoteDir
+
+		env = git.BuildEnvironment{
+			Logger: scribe.NewLogger(ioutil.Discard),
+			BuildPackYML: git.BuildPackYML{
+				Prefetch: []string{remote},
+			},
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(remoteDir)).To(Succeed())
+		Expect(os.RemoveAll(layersDir)).To(Succeed())
+		unsetInsteadOf()
+	})
+
+	it("clones and updates bare mirrors in a cache layer and redirects fetches to them", func() {
+		first := commit("first")
+
+		layer, err := packit.Layers{Path: layersDir}.Get(git.PrefetchLayerName)
+		Expect(err).NotTo(HaveOccurred())
+
+		fetchTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		layer, err = env.Prefetch(layer, fetchTime)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(layer.Build).To(BeTrue())
+		Expect(layer.Cache).To(BeTrue())
+		Expect(layer.Launch).To(BeFalse())
+
+		mirrors, ok := layer.Metadata["mirrors"].([]map[string]interface{})
+		Expect(ok).To(BeTrue())
+		Expect(mirrors).To(HaveLen(1))
+		Expect(mirrors[0]["remote"]).To(Equal(remote))
+		Expect(mirrors[0]["last_fetch"]).To(Equal("2024-01-02T03:04:05Z"))
+
+		mirrorPath := filepath.Join(layer.Path, mirrors[0]["directory"].(string))
+		Expect(run(mirrorPath, "rev-parse", "HEAD")).To(Equal(first))
+
+		insteadOf, err := exec.Command("git", "config", "--global", "--get-all", "url.file://"+mirrorPath+".insteadOf").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.TrimSpace(string(insteadOf))).To(Equal(remote + ".git"))
+
+		insteadOf, err = exec.Command("git", "config", "--global", "--get-all", "url.file://"+mirrorPath+"/.insteadOf").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.TrimSpace(string(insteadOf))).To(Equal(remote + "/"))
+
+		Expect(run(remoteDir, "ls-remote", remote+".git", "HEAD")).To(HavePrefix(first))
+		Expect(run(remoteDir, "ls-remote", remote+"/", "HEAD")).To(HavePrefix(first))
+
+		// the mirror is restored from the cache in the next build
+		unsetInsteadOf()
+		second := commit("second")
+
+		layer, err = env.Prefetch(layer, fetchTime.Add(time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(run(mirrorPath, "rev-parse", "HEAD")).To(Equal(second))
+		Expect(layer.Metadata["mirrors"].([]map[string]interface{})[0]["last_fetch"]).To(Equal("2024-01-02T04:04:05Z"))
+	})
+
+	it("removes mirrors of repositories which are no longer prefetched", func() {
+		commit("first")
+
+		layer, err := packit.Layers{Path: layersDir}.Get(git.PrefetchLayerName)
+		Expect(err).NotTo(HaveOccurred())
+
+		layer, err = env.Prefetch(layer, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		mirrorPath := filepath.Join(layer.Path, layer.Metadata["mirrors"].([]map[string]interface{})[0]["directory"].(string))
+
+		unsetInsteadOf()
+		env.BuildPackYML.Prefetch = nil
+		_, err = env.Prefetch(layer, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mirrorPath).NotTo(BeADirectory())
+	})
+
+	it("normalizes remotes and removes user information before cloning", func() {
+		commit("first")
+		env.BuildPackYML.Prefetch = []string{"file://user:token@" + remoteDir + ".git/", remote}
+
+		layer, err := packit.Layers{Path: layersDir}.Get(git.PrefetchLayerName)
+		Expect(err).NotTo(HaveOccurred())
+
+		layer, err = env.Prefetch(layer, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+
+		mirrors := layer.Metadata["mirrors"].([]map[string]interface{})
+		Expect(mirrors).To(HaveLen(1))
+		Expect(mirrors[0]["remote"]).To(Equal(remote))
+
+		config, err := ioutil.ReadFile(filepath.Join(layer.Path, mirrors[0]["directory"].(string), "config"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(config)).NotTo(ContainSubstring("token"))
+	})
+
+	it("does not redirect repositories whose URL starts with a prefetched remote", func() {
+		commit("first")
+
+		siblingDir := remoteDir + "-utils"
+		Expect(os.MkdirAll(siblingDir, 0755)).To(Succeed())
+		defer os.RemoveAll(siblingDir)
+		run(siblingDir, "init", "--quiet")
+		run(siblingDir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--allow-empty", "--quiet", "-m", "sibling")
+		sibling := run(siblingDir, "rev-parse", "HEAD")
+
+		layer, err := packit.Layers{Path: layersDir}.Get(git.PrefetchLayerName)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = env.Prefetch(layer, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(run(siblingDir, "ls-remote", remote+"-utils", "HEAD")).To(HavePrefix(sibling))
+		Expect(run(siblingDir, "ls-remote", remote+"-utils/", "HEAD")).To(HavePrefix(sibling))
+	})
+}
@@ -0,0 +1,89 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ProviderPreset describes the conventions of a Git hosting provider for
+// authenticating with an access token via HTTPS
+type ProviderPreset struct {
+	// Host is the host of the SaaS offering of the provider. Self-hosted
+	// instances override it with the host of the credential.
+	Host string
+
+	// Username is the username expected alongside an access token
+	Username string
+
+	// SSHUser is the user of SSH clone URLs. If set, ssh://<user>@<host>/
+	// URLs are rewritten to HTTPS in addition to <user>@<host>: URLs.
+	SSHUser string
+}
+
+// ProviderPresets maps the names accepted in the provider field of a
+// credential and in $GIT_CREDENTIALS_PROVIDER to their presets
+var ProviderPresets = map[string]ProviderPreset{
+	"github":       {Host: "github.com", Username: "x-access-token", SSHUser: "git"},
+	"gitlab":       {Host: "gitlab.com", Username: "oauth2", SSHUser: "git"},
+	"gitlab-ci":    {Host: "gitlab.com", Username: "gitlab-ci-token", SSHUser: "git"},
+	"bitbucket":    {Host: "bitbucket.org", Username: "x-token-auth", SSHUser: "git"},
+	"azure-devops": {Host: "dev.azure.com", Username: "pat"},
+	"gitea":        {Host: "gitea.com", Username: "oauth2", SSHUser: "git"},
+}
+
+// WithPreset returns the credential with its host, username and URL rewrites
+// filled in from the preset of its provider. Values specified in the
+// credential take precedence over the preset.
+func (c GitCredential) WithPreset() (GitCredential, error) {
+	if c.Provider == "" {
+		return c, nil
+	}
+
+	preset, ok := ProviderPresets[strings.ToLower(c.Provider)]
+	if !ok {
+		names := make([]string, 0, len(ProviderPresets))
+		for name := range ProviderPresets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return GitCredential{}, fmt.Errorf("unknown provider %q, supported providers are: %s", c.Provider, strings.Join(names, ", "))
+	}
+
+	if c.Host == "" && c.URL == "" {
+		c.Host = preset.Host
+	}
+
+	if c.IsSSH() {
+		if c.Username == "" {
+			c.Username = preset.SSHUser
+		}
+		return c.WithDefaults(), nil
+	}
+
+	if c.Username == "" {
+		c.Username = preset.Username
+	}
+
+	// the scp-like <user>@<host>: form is always rewritten by Configure, the
+	// ssh:// form has to be added here
+	if preset.SSHUser != "" && c.Host != "" {
+		c.InsteadOf = append(c.InsteadOf, "ssh://"+preset.SSHUser+"@"+c.Host+"/")
+	}
+
+	return c.WithDefaults(), nil
+}
+
+// ApplyProviderPresets applies the preset of its provider to each credential
+func ApplyProviderPresets(credentials []GitCredential) ([]GitCredential, error) {
+	for i, credential := range credentials {
+		credential, err := credential.WithPreset()
+		if err != nil {
+			return nil, err
+		}
+		credentials[i] = credential
+	}
+
+	return credentials, nil
+}
@@ -0,0 +1,79 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testPreset(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	context("WithPreset", func() {
+		it("fills in host, username and URL rewrites", func() {
+			credential, err := git.GitCredential{Provider: "GitHub", Password: "token"}.WithPreset()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credential).To(Equal(git.GitCredential{
+				Provider:  "GitHub",
+				Protocol:  "https",
+				Host:      "github.com",
+				Path:      "/",
+				Username:  "x-access-token",
+				Password:  "token",
+				InsteadOf: []string{"ssh://git@github.com/"},
+			}))
+		})
+
+		it("uses the username conventions of each provider", func() {
+			for provider, username := range map[string]string{
+				"gitlab":       "oauth2",
+				"gitlab-ci":    "gitlab-ci-token",
+				"bitbucket":    "x-token-auth",
+				"azure-devops": "pat",
+				"gitea":        "oauth2",
+			} {
+				credential, err := git.GitCredential{Provider: provider, Password: "token"}.WithPreset()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(credential.Username).To(Equal(username))
+			}
+		})
+
+		it("supports self-hosted instances and explicit usernames", func() {
+			credential, err := git.GitCredential{Provider: "gitlab", Host: "gitlab.example.com", Username: "bot", Password: "token"}.WithPreset()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credential.Host).To(Equal("gitlab.example.com"))
+			Expect(credential.Username).To(Equal("bot"))
+			Expect(credential.InsteadOf).To(Equal([]string{"ssh://git@gitlab.example.com/"}))
+		})
+
+		it("does not rewrite URLs for Azure DevOps", func() {
+			credential, err := git.GitCredential{Provider: "azure-devops", Password: "token"}.WithPreset()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credential.Host).To(Equal("dev.azure.com"))
+			Expect(credential.InsteadOf).To(BeEmpty())
+		})
+
+		it("uses the SSH user for SSH credentials", func() {
+			credential, err := git.GitCredential{Provider: "bitbucket", SSHKey: "key"}.WithPreset()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credential.Host).To(Equal("bitbucket.org"))
+			Expect(credential.Username).To(Equal("git"))
+			Expect(credential.Protocol).To(Equal("ssh"))
+			Expect(credential.InsteadOf).To(BeEmpty())
+		})
+
+		it("leaves credentials without a provider untouched", func() {
+			credential, err := git.GitCredential{Host: "example.com"}.WithPreset()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credential).To(Equal(git.GitCredential{Host: "example.com"}))
+		})
+
+		it("fails for unknown providers", func() {
+			_, err := git.GitCredential{Provider: "sourceforge"}.WithPreset()
+			Expect(err).To(MatchError(`unknown provider "sourceforge", supported providers are: azure-devops, bitbucket, gitea, github, gitlab, gitlab-ci`))
+		})
+	})
+}
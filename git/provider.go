@@ -0,0 +1,140 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// DefaultProviderTimeout is the time a credential provider may run unless
+// configured otherwise
+const DefaultProviderTimeout = 60 * time.Second
+
+// ProviderRequestVersion is the version of the JSON document credential
+// providers receive on stdin
+const ProviderRequestVersion = "1"
+
+// CredentialProvider is an external executable which supplies credentials,
+// e.g. a wrapper around a password manager CLI
+type CredentialProvider struct {
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	Timeout string   `yaml:"timeout"`
+}
+
+// ProviderRequest is written to the stdin of a credential provider
+type ProviderRequest struct {
+	Version     string `json:"version"`
+	WorkingDir  string `json:"working_dir"`
+	PlatformDir string `json:"platform_dir"`
+}
+
+// ProviderResponse is expected on the stdout of a credential provider
+type ProviderResponse struct {
+	Credentials []GitCredential `json:"credentials"`
+}
+
+// resolveProviders returns the providers of the buildpack.yml and the provider
+// given by the environment variable GIT_CREDENTIALS_PROVIDER_COMMAND
+func resolveProviders(buildPackYML BuildPackYML) ([]CredentialProvider, error) {
+	providers := append([]CredentialProvider{}, buildPackYML.Providers...)
+
+	gitProviderCommand, commandExists := os.LookupEnv("GIT_CREDENTIALS_PROVIDER_COMMAND")
+	if commandExists && len(gitProviderCommand) > 0 {
+		providers = append(providers, CredentialProvider{Command: gitProviderCommand})
+	}
+
+	for i, provider := range providers {
+		if provider.Command == "" {
+			return nil, fmt.Errorf("credential provider #%d does not specify a command", i+1)
+		}
+	}
+
+	return providers, nil
+}
+
+// Run executes the provider and returns the credentials it printed. Commands
+// containing a "/" are resolved relative to the app directory, others are
+// looked up in $PATH. A non-zero exit status, a timeout or invalid output fail
+// with an error containing the redacted stderr of the provider.
+func (p CredentialProvider) Run(workingDir string, platformPath string, logger scribe.Logger) ([]GitCredential, error) {
+	timeout := DefaultProviderTimeout
+	if p.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(p.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout %q of credential provider %s", p.Timeout, p.Command)
+		}
+	}
+
+	command := p.Command
+	if strings.Contains(command, "/") && !filepath.IsAbs(command) {
+		command = filepath.Join(workingDir, command)
+	}
+
+	request, err := json.Marshal(ProviderRequest{
+		Version:     ProviderRequestVersion,
+		WorkingDir:  workingDir,
+		PlatformDir: platformPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command, p.Args...)
+	cmd.Dir = workingDir
+	cmd.Stdin = bytes.NewReader(request)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("credential provider %s timed out after %s", p.Command, timeout)
+	}
+
+	if err != nil {
+		message := strings.TrimSpace(Redact(stderr.String()))
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if message == "" {
+				return nil, fmt.Errorf("credential provider %s failed with exit code %d", p.Command, exitErr.ExitCode())
+			}
+			return nil, fmt.Errorf("credential provider %s failed with exit code %d: %s", p.Command, exitErr.ExitCode(), message)
+		}
+		return nil, fmt.Errorf("failed to run credential provider %s: %w", p.Command, err)
+	}
+
+	var response ProviderResponse
+	err = json.Unmarshal(stdout.Bytes(), &response)
+	if err != nil {
+		return nil, fmt.Errorf("credential provider %s printed invalid JSON: %s", p.Command, Redact(err.Error()))
+	}
+
+	if stderr.Len() > 0 {
+		logger.Subprocess("Provider stderr: %s", strings.TrimSpace(Redact(stderr.String(), credentialSecrets(response.Credentials)...)))
+	}
+
+	var credentials []GitCredential
+	for i, credential := range response.Credentials {
+		if credential.Host == "" && credential.URL == "" && credential.Provider == "" {
+			return nil, fmt.Errorf("credential #%d of credential provider %s does not specify a host", i+1, p.Command)
+		}
+		credentials = append(credentials, credential.WithDefaults())
+	}
+
+	return credentials, nil
+}
@@ -0,0 +1,135 @@
+package git
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ProxyConfig represents an HTTP proxy used to reach GIT servers
+type ProxyConfig struct {
+	// URL is the URL of the proxy, e.g. http://proxy.example.com:3128
+	URL      string `yaml:"url" json:"url"`
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+
+	// NoProxy lists hosts or URLs which are reached directly. It is only
+	// supported in the top-level proxy section.
+	NoProxy []string `yaml:"no_proxy" json:"no_proxy"`
+}
+
+// configValue returns the value of http.proxy including the proxy
+// credentials
+func (p ProxyConfig) configValue() (string, error) {
+	proxyURL, err := url.Parse(p.URL)
+	if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+		// the URL is not part of the error as it may contain credentials
+		return "", errors.New("invalid proxy URL: a protocol and host are required, e.g. http://proxy.example.com:3128")
+	}
+
+	if p.Username != "" {
+		if p.Password != "" {
+			proxyURL.User = url.UserPassword(p.Username, p.Password)
+		} else {
+			proxyURL.User = url.User(p.Username)
+		}
+	}
+
+	return proxyURL.String(), nil
+}
+
+// secrets returns the proxy password in all forms it may appear in
+func (p ProxyConfig) secrets() []string {
+	if p.Password == "" {
+		return nil
+	}
+	return []string{p.Password, strings.TrimPrefix(url.UserPassword("", p.Password).String(), ":")}
+}
+
+// HasProxyConfig reports whether a proxy is configured for any credential or
+// in the top-level proxy section
+func (e BuildEnvironment) HasProxyConfig() bool {
+	if e.BuildPackYML.Proxy.URL != "" || len(e.BuildPackYML.Proxy.NoProxy) > 0 {
+		return true
+	}
+
+	for _, credential := range e.BuildPackYML.Credentials {
+		if credential.Proxy != nil && !credential.IsSSH() {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigureProxy directs GIT to use the top-level proxy via http.proxy, the
+// proxies of credentials via http.<url>.proxy and to bypass proxies for the
+// hosts in the no-proxy list
+func (e BuildEnvironment) ConfigureProxy() error {
+	e.Logger.Process("Configuring git to use HTTP proxies")
+
+	proxy := e.BuildPackYML.Proxy
+	if proxy.URL != "" {
+		value, err := proxy.configValue()
+		if err != nil {
+			return err
+		}
+
+		err = e.runGitCommand([]string{
+			"git",
+			"config",
+			"--global",
+			"http.proxy",
+			value,
+		}, proxy.secrets()...)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, credential := range e.BuildPackYML.Credentials {
+		if credential.Proxy == nil || credential.IsSSH() {
+			continue
+		}
+
+		value, err := credential.Proxy.configValue()
+		if err != nil {
+			return err
+		}
+
+		err = e.runGitCommand([]string{
+			"git",
+			"config",
+			"--global",
+			"http." + credential.configURL() + ".proxy",
+			value,
+		}, credential.Proxy.secrets()...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// an empty http.<url>.proxy disables proxying for matching URLs
+	for _, noProxy := range proxy.NoProxy {
+		noProxy = strings.TrimSpace(noProxy)
+		if noProxy == "" {
+			continue
+		}
+
+		if !strings.Contains(noProxy, "://") {
+			noProxy = "https://" + noProxy
+		}
+
+		err := e.RunGitCommand([]string{
+			"git",
+			"config",
+			"--global",
+			"http." + noProxy + ".proxy",
+			"",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
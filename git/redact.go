@@ -0,0 +1,36 @@
+package git
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RedactedPlaceholder replaces secrets in log output
+const RedactedPlaceholder = "[REDACTED]"
+
+var (
+	redactURLUserinfo = regexp.MustCompile(`://[^/\s@]+@`)
+	redactKeyValue    = regexp.MustCompile(`(?i)\b(password|passwd|passphrase|token|secret|private[_-]?key|authorization)(["']?\s*[:=]\s*["']?)(bearer\s+|basic\s+)?[^\s"',]+`)
+)
+
+// Redact removes the given secrets as well as anything that looks like a
+// password, token or URL userinfo from text before it is logged
+func Redact(text string, secrets ...string) string {
+	for _, secret := range secrets {
+		if len(secret) > 0 {
+			text = strings.ReplaceAll(text, secret, RedactedPlaceholder)
+		}
+	}
+
+	text = redactURLUserinfo.ReplaceAllString(text, "://"+RedactedPlaceholder+"@")
+	return redactKeyValue.ReplaceAllString(text, "${1}${2}${3}"+RedactedPlaceholder)
+}
+
+// credentialSecrets returns the secrets of the given credentials
+func credentialSecrets(credentials []GitCredential) []string {
+	var secrets []string
+	for _, credential := range credentials {
+		secrets = append(secrets, credential.Password, credential.SSHKey, credential.Cookies, credential.Passphrase)
+	}
+	return secrets
+}
@@ -0,0 +1,169 @@
+package git
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2"
+)
+
+// CredentialsHostsEnv is the build environment variable listing the hosts and
+// paths covered by credentials, e.g. "github.com,gitlab.com/group"
+const CredentialsHostsEnv = "GIT_CREDENTIALS_HOSTS"
+
+// StrictEnabled reports whether requirements which are not covered by any
+// credential fail the build, either because "strict" is set in the
+// buildpack.yml or because the environment variable GIT_CREDENTIALS_STRICT is
+// set to a true value
+func StrictEnabled(buildPackYML BuildPackYML) (bool, error) {
+	enabled, err := lookupEnvBool("GIT_CREDENTIALS_STRICT")
+	if err != nil {
+		return false, err
+	}
+
+	return enabled || buildPackYML.Strict, nil
+}
+
+// RequiredHosts merges the hosts other buildpacks require via the metadata of
+// their gitcredentials build plan requirements, e.g.
+// {hosts: ["github.com/acme"]}
+func RequiredHosts(plan packit.BuildpackPlan) ([]string, error) {
+	var hosts []string
+	seen := map[string]bool{}
+	for _, entry := range plan.Entries {
+		if entry.Name != "gitcredentials" {
+			continue
+		}
+
+		value, ok := entry.Metadata["hosts"]
+		if !ok {
+			continue
+		}
+
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid build plan metadata: hosts must be a list of strings, got %T", value)
+		}
+
+		for _, item := range list {
+			host, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid build plan metadata: hosts must be a list of strings, got %T", item)
+			}
+
+			host = normalizeHostPath(host)
+			if host == "" || seen[host] {
+				continue
+			}
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts, nil
+}
+
+// normalizeHostPath turns a host or a URL into host and path without scheme,
+// user, ".git" suffix and trailing slashes, e.g. "https://github.com/acme/"
+// becomes "github.com/acme"
+func normalizeHostPath(value string) string {
+	value = strings.TrimSpace(value)
+	if _, rest, found := strings.Cut(value, "://"); found {
+		value = rest
+	}
+	if at := strings.Index(value, "@"); at >= 0 && at < strings.Index(value+"/", "/") {
+		value = value[at+1:]
+	}
+
+	host, repoPath, _ := strings.Cut(value, "/")
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	host = strings.ToLower(host)
+	if repoPath == "" {
+		return host
+	}
+
+	return host + "/" + repoPath
+}
+
+// coveredHostPath returns the host and path a credential applies to in the
+// format of normalizeHostPath
+func (c GitCredential) coveredHostPath() string {
+	host := c.Host
+	prefix := ""
+	if c.URL != "" {
+		credentialURL, err := url.Parse(c.URL)
+		if err == nil {
+			host = credentialURL.Host
+			prefix = credentialURL.Path
+		}
+	}
+	if c.IsSSH() {
+		host = sshHostName(host)
+	}
+
+	return normalizeHostPath(host + path.Join("/", prefix, c.Path))
+}
+
+// CoveredHosts returns the sorted hosts and paths covered by the credentials
+func CoveredHosts(credentials []GitCredential) []string {
+	var hosts []string
+	seen := map[string]bool{}
+	for _, credential := range credentials {
+		host := credential.coveredHostPath()
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	return hosts
+}
+
+// hostCovered reports whether the host and path required is covered by one of
+// the covered hosts and paths, i.e. it is equal to or below one of them
+func hostCovered(covered []string, required string) bool {
+	for _, host := range covered {
+		if required == host || strings.HasPrefix(required, host+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRequiredHosts checks that each required host and path is covered by a
+// credential. Uncovered hosts are reported as warnings, in strict mode they
+// fail the build.
+func (e BuildEnvironment) CheckRequiredHosts(required []string, strict bool) error {
+	e.Logger.Process("Checking hosts required by other buildpacks")
+
+	covered := CoveredHosts(e.BuildPackYML.Credentials)
+	var uncovered []string
+	for _, host := range required {
+		if hostCovered(covered, host) {
+			e.Logger.Subprocess("%s: covered", host)
+			continue
+		}
+
+		e.Logger.Subprocess("%s: not covered by any credential", host)
+		uncovered = append(uncovered, host)
+	}
+	e.Logger.Break()
+
+	if len(uncovered) == 0 {
+		return nil
+	}
+
+	if strict {
+		return fmt.Errorf("required hosts are not covered by any credential: %s", strings.Join(uncovered, ", "))
+	}
+
+	e.Logger.Subprocess("Warning: required hosts are not covered by any credential: %s", strings.Join(uncovered, ", "))
+	e.Logger.Break()
+
+	return nil
+}
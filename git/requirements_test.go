@@ -0,0 +1,113 @@
+package git_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testRequirements(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+	)
+
+	context("RequiredHosts", func() {
+		it("merges and normalizes the hosts of all gitcredentials requirements", func() {
+			hosts, err := git.RequiredHosts(packit.BuildpackPlan{
+				Entries: []packit.BuildpackPlanEntry{
+					{Name: "gitcredentials"},
+					{Name: "gitcredentials", Metadata: map[string]interface{}{"hosts": []interface{}{"github.com/acme", "GitLab.com"}}},
+					{Name: "gitcredentials", Metadata: map[string]interface{}{"hosts": []interface{}{"https://github.com/acme/", "git@bitbucket.org/team/repo.git"}}},
+					{Name: "go", Metadata: map[string]interface{}{"hosts": []interface{}{"example.com"}}},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hosts).To(Equal([]string{"github.com/acme", "gitlab.com", "bitbucket.org/team/repo"}))
+		})
+
+		it("returns an error for invalid metadata", func() {
+			_, err := git.RequiredHosts(packit.BuildpackPlan{
+				Entries: []packit.BuildpackPlanEntry{
+					{Name: "gitcredentials", Metadata: map[string]interface{}{"hosts": "github.com"}},
+				},
+			})
+			Expect(err).To(MatchError("invalid build plan metadata: hosts must be a list of strings, got string"))
+		})
+	})
+
+	context("CoveredHosts", func() {
+		it("returns the hosts and paths of all credentials", func() {
+			Expect(git.CoveredHosts([]git.GitCredential{
+				{Protocol: "https", Host: "github.com", Path: "/", Username: "user", Password: "token"},
+				{Protocol: "https", Host: "gitlab.com", Path: "/group/", Username: "user", Password: "token"},
+				{Protocol: "https", Host: "ignored.example.com", URL: "https://git.example.com/scm", Path: "/team"},
+				{Host: "git@bitbucket.org", SSHKey: "key"},
+				{Protocol: "https", Host: "github.com", Path: "/org/repo.git"},
+			})).To(Equal([]string{"bitbucket.org", "git.example.com/scm/team", "github.com", "github.com/org/repo", "gitlab.com/group"}))
+		})
+	})
+
+	context("CheckRequiredHosts", func() {
+		var (
+			buffer *bytes.Buffer
+			env    git.BuildEnvironment
+		)
+
+		it.Before(func() {
+			buffer = bytes.NewBuffer(nil)
+			env = git.BuildEnvironment{
+				Logger: scribe.NewLogger(buffer),
+				BuildPackYML: git.BuildPackYML{
+					Credentials: []git.GitCredential{
+						{Protocol: "https", Host: "github.com", Path: "/acme", Username: "user", Password: "token"},
+					},
+				},
+			}
+		})
+
+		it("accepts hosts and paths below a credential", func() {
+			Expect(env.CheckRequiredHosts([]string{"github.com/acme", "github.com/acme/repo"}, true)).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("github.com/acme/repo: covered"))
+		})
+
+		it("warns about uncovered hosts", func() {
+			Expect(env.CheckRequiredHosts([]string{"github.com/acme-other", "gitlab.com"}, false)).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Warning: required hosts are not covered by any credential: github.com/acme-other, gitlab.com"))
+		})
+
+		it("fails for uncovered hosts in strict mode", func() {
+			err := env.CheckRequiredHosts([]string{"github.com", "github.com/acme"}, true)
+			Expect(err).To(MatchError("required hosts are not covered by any credential: github.com"))
+		})
+	})
+
+	context("StrictEnabled", func() {
+		it.After(func() {
+			os.Unsetenv("GIT_CREDENTIALS_STRICT")
+		})
+
+		it("is disabled by default", func() {
+			strict, err := git.StrictEnabled(git.BuildPackYML{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strict).To(BeFalse())
+		})
+
+		it("is enabled by the buildpack.yml or GIT_CREDENTIALS_STRICT", func() {
+			strict, err := git.StrictEnabled(git.BuildPackYML{Strict: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strict).To(BeTrue())
+
+			os.Setenv("GIT_CREDENTIALS_STRICT", "1")
+			strict, err = git.StrictEnabled(git.BuildPackYML{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strict).To(BeTrue())
+		})
+	})
+}
@@ -0,0 +1,334 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// ReadCredentialSources collects credentials from all sources besides the
+// credentials array of the buildpack.yml and the GIT_CREDENTIALS_USERNAME /
+// GIT_CREDENTIALS_PASSWORD environment variables
+func ReadCredentialSources(workingDir string, platformPath string, buildPackYML BuildPackYML, logger scribe.Logger) ([]GitCredential, error) {
+	credentials, err := readLocalSources(workingDir, platformPath, buildPackYML, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	vcapCredentials, err := readVCAPServices(buildPackYML, logger)
+	if err != nil {
+		return nil, err
+	}
+	credentials = append(credentials, vcapCredentials...)
+
+	vaultConfig, err := ResolveVaultConfig(buildPackYML.Vault, workingDir, platformPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if vaultConfig.Enabled() {
+		logger.Process("Using credentials from Vault at %s", vaultConfig.Address)
+		client, err := NewVaultClient(vaultConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		vaultCredentials, err := client.ReadCredentials()
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, vaultCredentials...)
+	}
+
+	providers, err := resolveProviders(buildPackYML)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, provider := range providers {
+		logger.Process("Using credentials from provider %s", provider.Command)
+		providerCredentials, err := provider.Run(workingDir, platformPath, logger)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, providerCredentials...)
+	}
+
+	return credentials, nil
+}
+
+// CredentialSourcesConfigured reports whether any of the sources read by
+// ReadCredentialSources is configured. Unlike ReadCredentialSources it
+// neither contacts remote services nor runs credential providers.
+func CredentialSourcesConfigured(workingDir string, platformPath string, buildPackYML BuildPackYML, logger scribe.Logger) (bool, error) {
+	credentials, err := readLocalSources(workingDir, platformPath, buildPackYML, logger)
+	if err != nil {
+		return false, err
+	}
+	if len(credentials) > 0 {
+		return true, nil
+	}
+
+	vcapServices, vcapServicesExists := os.LookupEnv("VCAP_SERVICES")
+	if vcapServicesExists && len(vcapServices) > 0 {
+		instances, err := ParseVCAPServices(vcapServices, vcapLabel(buildPackYML))
+		if err != nil {
+			return false, err
+		}
+		if len(instances) > 0 {
+			return true, nil
+		}
+	}
+
+	vaultConfig, err := ResolveVaultConfig(buildPackYML.Vault, workingDir, platformPath)
+	if err != nil {
+		return false, err
+	}
+	if vaultConfig.Enabled() {
+		return true, nil
+	}
+
+	providers, err := resolveProviders(buildPackYML)
+	if err != nil {
+		return false, err
+	}
+
+	return len(providers) > 0, nil
+}
+
+// readLocalSources collects credentials from sources which are available on
+// the file system or in the environment
+func readLocalSources(workingDir string, platformPath string, buildPackYML BuildPackYML, logger scribe.Logger) ([]GitCredential, error) {
+	var credentials []GitCredential
+
+	urlCredential, ok, err := envURLCredential()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		logger.Process("Using credentials from environment variable GIT_CREDENTIALS_URL")
+		credentials = append(credentials, urlCredential)
+	}
+
+	credentialFiles := []string{}
+	if buildPackYML.CredentialsFile != "" {
+		credentialFiles = append(credentialFiles, buildPackYML.CredentialsFile)
+	}
+	gitCredentialsFile, fileExists := os.LookupEnv("GIT_CREDENTIALS_FILE")
+	if fileExists && len(gitCredentialsFile) > 0 {
+		credentialFiles = append(credentialFiles, gitCredentialsFile)
+	}
+
+	for _, path := range credentialFiles {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workingDir, path)
+		}
+
+		logger.Process("Using credentials from file %s", path)
+		fileCredentials, err := ReadCredentialStoreFile(path)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, fileCredentials...)
+	}
+
+	tektonDir := DefaultTektonCredsDir
+	gitTektonDir, tektonDirExists := os.LookupEnv("GIT_CREDENTIALS_TEKTON_DIR")
+	if tektonDirExists && len(gitTektonDir) > 0 {
+		tektonDir = gitTektonDir
+	}
+
+	tektonCredentials, err := ReadTektonCredentials(tektonDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(tektonCredentials) > 0 {
+		logger.Process("Using Tekton credentials from %s", tektonDir)
+		credentials = append(credentials, tektonCredentials...)
+	}
+
+	kpackDir := DefaultKpackSecretsDir
+	gitKpackDir, kpackDirExists := os.LookupEnv("GIT_CREDENTIALS_KPACK_DIR")
+	if kpackDirExists && len(gitKpackDir) > 0 {
+		kpackDir = gitKpackDir
+	}
+
+	kpackCredentials, err := ReadKpackCredentials(kpackDir, os.Getenv(KpackGitEnv))
+	if err != nil {
+		return nil, err
+	}
+	if len(kpackCredentials) > 0 {
+		logger.Process("Using kpack secrets from %s", kpackDir)
+		credentials = append(credentials, kpackCredentials...)
+	}
+
+	gitHubAppCredentials, err := readGitHubAppSources(platformPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(gitHubAppCredentials) > 0 {
+		logger.Process("Using GitHub App credentials")
+		credentials = append(credentials, gitHubAppCredentials...)
+	}
+
+	oidcCredentials, err := readOIDCExchangeSource()
+	if err != nil {
+		return nil, err
+	}
+	if len(oidcCredentials) > 0 {
+		logger.Process("Using OIDC token exchange for %s", oidcCredentials[0].Host)
+		credentials = append(credentials, oidcCredentials...)
+	}
+
+	codeCommitCredentials, err := readCodeCommitSources(platformPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(codeCommitCredentials) > 0 {
+		logger.Process("Using CodeCommit credentials")
+		credentials = append(credentials, codeCommitCredentials...)
+	}
+
+	mirrorCredentials, err := MirrorCredentials(buildPackYML.Mirrors)
+	if err != nil {
+		return nil, err
+	}
+	if len(mirrorCredentials) > 0 {
+		logger.Process("Using credentials of mirrors")
+		credentials = append(credentials, mirrorCredentials...)
+	}
+
+	bindingCredentials, err := readCredentialsBindings(platformPath, logger)
+	if err != nil {
+		return nil, err
+	}
+	credentials = append(credentials, bindingCredentials...)
+
+	return credentials, nil
+}
+
+// readCredentialsBindings collects credentials in the format of the GIT
+// credential store from the entry "credentials" of service bindings of type
+// git-credentials
+func readCredentialsBindings(platformPath string, logger scribe.Logger) ([]GitCredential, error) {
+	var credentials []GitCredential
+
+	bindings, err := ResolveBindings(CredentialsBindingType, platformPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, binding := range bindings {
+		content, ok, err := bindingEntry(binding, "credentials")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		logger.Process("Using credentials from service binding %s", binding.Name)
+		bindingCredentials, err := ParseCredentialStore(strings.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse service binding %s: %w", binding.Name, err)
+		}
+		credentials = append(credentials, bindingCredentials...)
+	}
+
+	return credentials, nil
+}
+
+// readVCAPServices collects credentials from the Cloud Foundry service
+// instances in VCAP_SERVICES, resolving CredHub references if necessary
+func readVCAPServices(buildPackYML BuildPackYML, logger scribe.Logger) ([]GitCredential, error) {
+	vcapServices, vcapServicesExists := os.LookupEnv("VCAP_SERVICES")
+	if !vcapServicesExists || len(vcapServices) == 0 {
+		return nil, nil
+	}
+
+	instances, err := ParseVCAPServices(vcapServices, vcapLabel(buildPackYML))
+	if err != nil {
+		return nil, err
+	}
+
+	// only the service instances containing GIT credentials are resolved,
+	// references of other services must not fail the build
+	selected, err := vcapServicesOf(instances)
+	if err != nil {
+		return nil, err
+	}
+
+	if ContainsCredHubRefs(selected) {
+		logger.Process("Resolving CredHub references in VCAP_SERVICES")
+		client, err := NewCredHubClient(os.Getenv("CREDHUB_API"), os.Getenv("CF_INSTANCE_CERT"), os.Getenv("CF_INSTANCE_KEY"), os.Getenv("CF_SYSTEM_CERT_PATH"))
+		if err != nil {
+			return nil, err
+		}
+
+		selected, err = client.Interpolate(selected)
+		if err != nil {
+			return nil, err
+		}
+
+		instances, err = ParseVCAPServices(selected, vcapLabel(buildPackYML))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var credentials []GitCredential
+	for _, instance := range instances {
+		instanceCredentials, err := instance.GitCredentials()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, credential := range instanceCredentials {
+			host := credential.Host
+			if credential.URL != "" {
+				host = credential.URL
+			}
+			logger.Process("Using credentials for %s from service instance %s", host, instance.Name)
+		}
+		credentials = append(credentials, instanceCredentials...)
+	}
+
+	return credentials, nil
+}
+
+// vcapLabel returns the label of Cloud Foundry services containing GIT
+// credentials
+func vcapLabel(buildPackYML BuildPackYML) string {
+	gitVCAPLabel, vcapLabelExists := os.LookupEnv("GIT_CREDENTIALS_VCAP_LABEL")
+	if vcapLabelExists && len(gitVCAPLabel) > 0 {
+		return gitVCAPLabel
+	}
+	return buildPackYML.VCAPLabel
+}
+
+// envURLCredential returns the credential contained in the userinfo of the
+// environment variable GIT_CREDENTIALS_URL. It is only used if neither
+// GIT_CREDENTIALS_USERNAME nor GIT_CREDENTIALS_PASSWORD are set, otherwise
+// GIT_CREDENTIALS_URL keeps its meaning as the URL of those credentials.
+func envURLCredential() (GitCredential, bool, error) {
+	gitUserName, userNameExists := os.LookupEnv("GIT_CREDENTIALS_USERNAME")
+	gitPassword, passwordExists := os.LookupEnv("GIT_CREDENTIALS_PASSWORD")
+	if (userNameExists && len(gitUserName) > 0) || (passwordExists && len(gitPassword) > 0) {
+		return GitCredential{}, false, nil
+	}
+
+	gitURL, urlExists := os.LookupEnv("GIT_CREDENTIALS_URL")
+	if !urlExists || !strings.Contains(gitURL, "@") {
+		return GitCredential{}, false, nil
+	}
+
+	credential, err := ParseCredentialURL(gitURL)
+	if err != nil {
+		return GitCredential{}, false, fmt.Errorf("invalid GIT_CREDENTIALS_URL: %w", err)
+	}
+
+	return credential, true, nil
+}
@@ -0,0 +1,282 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SSHDirName is the name of the directory within the gitcredentials layer
+// containing SSH keys, known hosts and the generated ssh_config
+const SSHDirName = "ssh"
+
+// HasSSHCredentials reports whether any credential authenticates via SSH
+func (e BuildEnvironment) HasSSHCredentials() bool {
+	for _, credential := range e.BuildPackYML.Credentials {
+		if credential.IsSSH() {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigureSSH writes the SSH keys of all SSH credentials into the given layer
+// directory, generates an ssh_config which maps each host to its keys and
+// directs GIT to use it via core.sshCommand. Keys of credentials with a path
+// are only used for that repository: they get a Host alias of their own and
+// the URLs of the repository are rewritten to the alias.
+func (e BuildEnvironment) ConfigureSSH(layerPath string) error {
+	e.Logger.Process("Configuring git to use SSH keys for authentication")
+
+	sshDir := filepath.Join(layerPath, SSHDirName)
+	err := os.MkdirAll(sshDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	knownHostsPath := filepath.Join(sshDir, "known_hosts")
+	var knownHosts strings.Builder
+
+	var hosts []string
+	hostConfig := map[string]*sshHost{}
+	var aliases []sshAlias
+	aliasRepoPaths := map[string]string{}
+	repoCredentials := map[string]int{}
+	knownHostNames := map[string]bool{}
+	var agentKeys []sshAgentKey
+	for i, credential := range e.BuildPackYML.Credentials {
+		if !credential.IsSSH() {
+			continue
+		}
+
+		hostName := sshHostName(credential.Host)
+		if hostName == "" {
+			return fmt.Errorf("SSH credential #%d does not specify a host", i+1)
+		}
+
+		keyPath := filepath.Join(sshDir, fmt.Sprintf("id_%d", i))
+		key := credential.SSHKey
+		if !strings.HasSuffix(key, "\n") {
+			// ssh refuses keys without a trailing newline
+			key += "\n"
+		}
+
+		err = ioutil.WriteFile(keyPath, []byte(key), 0600)
+		if err != nil {
+			return err
+		}
+
+		if credential.Passphrase != "" || credential.PassphraseEnv != "" {
+			passphrase, err := sshPassphrase(i, credential)
+			if err != nil {
+				return err
+			}
+			agentKeys = append(agentKeys, sshAgentKey{path: keyPath, passphrase: passphrase})
+		}
+
+		if credential.KnownHosts != "" {
+			knownHostNames[hostName] = true
+			knownHosts.WriteString(strings.TrimSpace(credential.KnownHosts) + "\n")
+		}
+
+		repoPath := sshRepoPath(credential.Path)
+		if repoPath != "" {
+			user := credential.Username
+			if user == "" {
+				user = "git"
+			}
+
+			// a repository can only be rewritten to a single alias, i.e. a
+			// single key
+			if j, ok := repoCredentials[hostName+":"+repoPath]; ok {
+				return fmt.Errorf("SSH credentials #%d and #%d conflict: both specify a key for %s:%s", j+1, i+1, hostName, repoPath)
+			}
+			repoCredentials[hostName+":"+repoPath] = i
+
+			// paths like org/repo and org-repo map to the same alias, later
+			// ones get a suffix derived from their path
+			alias := hostName + "-" + sshAliasPattern.ReplaceAllString(repoPath, "-")
+			if _, ok := aliasRepoPaths[alias]; ok {
+				sum := sha256.Sum256([]byte(hostName + ":" + repoPath))
+				alias += "-" + hex.EncodeToString(sum[:4])
+			}
+			aliasRepoPaths[alias] = repoPath
+
+			aliases = append(aliases, sshAlias{
+				alias:    alias,
+				hostName: hostName,
+				repoPath: repoPath,
+				host:     sshHost{user: user, identityFiles: []string{keyPath}},
+			})
+
+			e.Logger.Subprocess("Added SSH key for %s:%s", hostName, repoPath)
+			continue
+		}
+
+		config, ok := hostConfig[hostName]
+		if !ok {
+			config = &sshHost{user: credential.Username}
+			hostConfig[hostName] = config
+			hosts = append(hosts, hostName)
+		}
+		config.identityFiles = append(config.identityFiles, keyPath)
+
+		e.Logger.Subprocess("Added SSH key for %s", hostName)
+	}
+
+	err = ioutil.WriteFile(knownHostsPath, []byte(knownHosts.String()), 0600)
+	if err != nil {
+		return err
+	}
+
+	// encrypted keys are loaded into a dedicated ssh-agent, ssh must not
+	// prompt for their passphrases
+	agentSocket := ""
+	if len(agentKeys) > 0 {
+		agentSocket, err = e.startSSHAgent(sshDir)
+		if err != nil {
+			return err
+		}
+
+		err = e.addSSHAgentKeys(sshDir, agentSocket, agentKeys)
+		if err != nil {
+			return err
+		}
+	}
+
+	var sshConfig strings.Builder
+	for _, alias := range aliases {
+		alias.host.knownHosts = knownHostNames[alias.hostName]
+		alias.host.identityAgent = agentSocket
+		sshConfig.WriteString(alias.host.render(alias.alias, alias.hostName, knownHostsPath))
+	}
+
+	for _, hostName := range hosts {
+		config := hostConfig[hostName]
+		config.knownHosts = knownHostNames[hostName]
+		config.identityAgent = agentSocket
+		if !config.knownHosts {
+			e.Logger.Subprocess("No known hosts given for %s, accepting its host key on first use", hostName)
+		}
+
+		sshConfig.WriteString(config.render(hostName, hostName, knownHostsPath))
+	}
+
+	sshConfigPath := filepath.Join(sshDir, "ssh_config")
+	err = ioutil.WriteFile(sshConfigPath, []byte(sshConfig.String()), 0600)
+	if err != nil {
+		return err
+	}
+	e.Logger.Break()
+
+	err = e.RunGitCommand([]string{
+		"git",
+		"config",
+		"--global",
+		"core.sshCommand",
+		"ssh -F '" + sshConfigPath + "'",
+	})
+	if err != nil {
+		return err
+	}
+
+	// URLs with the default user "git" are rewritten as well, the alias
+	// connects with the user of the credential
+	for _, alias := range aliases {
+		users := []string{alias.host.user}
+		if alias.host.user != "git" {
+			users = append(users, "git")
+		}
+
+		var insteadOfs []string
+		for _, user := range users {
+			insteadOfs = append(insteadOfs,
+				user+"@"+alias.hostName+":"+alias.repoPath,
+				"ssh://"+user+"@"+alias.hostName+"/"+alias.repoPath,
+			)
+		}
+
+		for _, insteadOf := range insteadOfs {
+			err = e.RunGitCommand([]string{
+				"git",
+				"config",
+				"--global",
+				"--add",
+				"url." + alias.alias + ":" + alias.repoPath + ".insteadOf",
+				insteadOf,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// sshAliasPattern matches characters which are replaced in Host aliases
+var sshAliasPattern = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// sshAlias is a Host alias for the key of a single repository
+type sshAlias struct {
+	alias    string
+	hostName string
+	repoPath string
+	host     sshHost
+}
+
+// sshRepoPath returns the repository path of an SSH credential without
+// leading slash and .git suffix, or an empty string if the credential is not
+// scoped to a repository
+func sshRepoPath(path string) string {
+	return strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+}
+
+// sshHost collects the ssh_config settings of a single host
+type sshHost struct {
+	user          string
+	identityFiles []string
+	knownHosts    bool
+	identityAgent string
+}
+
+// render returns an ssh_config "Host" block
+func (h sshHost) render(alias string, hostName string, knownHostsPath string) string {
+	var bf strings.Builder
+	bf.WriteString("Host " + alias + "\n")
+	bf.WriteString("  HostName " + hostName + "\n")
+	if h.user != "" {
+		bf.WriteString("  User " + h.user + "\n")
+	}
+	for _, identityFile := range h.identityFiles {
+		bf.WriteString("  IdentityFile \"" + identityFile + "\"\n")
+	}
+	bf.WriteString("  IdentitiesOnly yes\n")
+	if h.identityAgent != "" {
+		bf.WriteString("  IdentityAgent \"" + h.identityAgent + "\"\n")
+	}
+	bf.WriteString("  UserKnownHostsFile \"" + knownHostsPath + "\"\n")
+	if h.knownHosts {
+		bf.WriteString("  StrictHostKeyChecking yes\n")
+	} else {
+		bf.WriteString("  StrictHostKeyChecking accept-new\n")
+	}
+	bf.WriteString("\n")
+
+	return bf.String()
+}
+
+// sshHostName strips a user and port from the host of an SSH credential, i.e.
+// "git@example.com:2222" becomes "example.com"
+func sshHostName(host string) string {
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	return (&url.URL{Host: host}).Hostname()
+}
@@ -0,0 +1,202 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// SSHAgentSocketName is the name of the socket of the ssh-agent within the
+	// SSH directory of the gitcredentials layer
+	SSHAgentSocketName = "agent.sock"
+
+	// SSHAgentPIDFileName is the name of the file within the SSH directory of
+	// the gitcredentials layer containing the PID of the ssh-agent
+	SSHAgentPIDFileName = "agent.pid"
+
+	// sshAskPassName is the name of the SSH_ASKPASS script which passes the
+	// passphrase of a key from the environment to ssh-add
+	sshAskPassName = "askpass"
+
+	sshPassphraseEnv  = "GIT_CREDENTIALS_SSH_PASSPHRASE"
+	sshAskPassOnceEnv = "GIT_CREDENTIALS_SSH_ASKPASS_ONCE"
+)
+
+// sshAskPassScript prints the passphrase only once per key, since ssh-add
+// asks again as long as the passphrase is wrong
+const sshAskPassScript = `#!/bin/sh
+if [ -e "$` + sshAskPassOnceEnv + `" ]; then
+  exit 1
+fi
+: > "$` + sshAskPassOnceEnv + `"
+printf '%s\n' "$` + sshPassphraseEnv + `"
+`
+
+var sshAgentPIDPattern = regexp.MustCompile(`SSH_AGENT_PID=(\d+)`)
+
+// HasSSHPassphrases reports whether any SSH credential has an encrypted key
+// which is loaded into an ssh-agent
+func (e BuildEnvironment) HasSSHPassphrases() bool {
+	for _, credential := range e.BuildPackYML.Credentials {
+		if credential.IsSSH() && (credential.Passphrase != "" || credential.PassphraseEnv != "") {
+			return true
+		}
+	}
+	return false
+}
+
+// sshPassphrase returns the passphrase of an SSH credential, either given
+// directly or read from the environment variable named by passphrase_env
+func sshPassphrase(index int, credential GitCredential) (string, error) {
+	if credential.Passphrase != "" {
+		return credential.Passphrase, nil
+	}
+
+	passphrase, exists := os.LookupEnv(credential.PassphraseEnv)
+	if !exists || len(passphrase) == 0 {
+		return "", fmt.Errorf("SSH credential #%d: environment variable %s is not set", index+1, credential.PassphraseEnv)
+	}
+
+	return passphrase, nil
+}
+
+// sshAgentKey is an encrypted key to be loaded into the ssh-agent
+type sshAgentKey struct {
+	path       string
+	passphrase string
+}
+
+// startSSHAgent starts a dedicated ssh-agent listening on a socket in the
+// given SSH directory and records its PID, so that it can be stopped by
+// StopSSHAgent
+func (e BuildEnvironment) startSSHAgent(sshDir string) (string, error) {
+	socketPath := filepath.Join(sshDir, SSHAgentSocketName)
+	err := os.Remove(socketPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	e.Logger.Subprocess("Starting ssh-agent")
+	output, err := exec.Command("ssh-agent", "-s", "-a", socketPath).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to start ssh-agent: %w", err)
+	}
+
+	match := sshAgentPIDPattern.FindSubmatch(output)
+	if match == nil {
+		return "", fmt.Errorf("failed to start ssh-agent: unexpected output %q", string(output))
+	}
+
+	err = ioutil.WriteFile(filepath.Join(sshDir, SSHAgentPIDFileName), append(match[1], '\n'), 0600)
+	if err != nil {
+		return "", err
+	}
+
+	return socketPath, nil
+}
+
+// addSSHAgentKeys loads the given keys into the ssh-agent listening on
+// socketPath. Passphrases are passed via SSH_ASKPASS, so they neither appear
+// on the command line nor on disk. Since ssh only offers agent keys whose
+// public key it knows, the public key of each key is written next to it.
+func (e BuildEnvironment) addSSHAgentKeys(sshDir string, socketPath string, keys []sshAgentKey) error {
+	askPassPath := filepath.Join(sshDir, sshAskPassName)
+	err := ioutil.WriteFile(askPassPath, []byte(sshAskPassScript), 0700)
+	if err != nil {
+		return err
+	}
+
+	env := append(os.Environ(),
+		"SSH_AUTH_SOCK="+socketPath,
+		"SSH_ASKPASS="+askPassPath,
+		"SSH_ASKPASS_REQUIRE=force",
+	)
+	if _, ok := os.LookupEnv("DISPLAY"); !ok {
+		// ssh-add versions without SSH_ASKPASS_REQUIRE only use SSH_ASKPASS if
+		// DISPLAY is set
+		env = append(env, "DISPLAY=none")
+	}
+
+	askPassOncePath := askPassPath + ".once"
+	defer os.Remove(askPassOncePath)
+
+	listed := map[string]bool{}
+	for _, key := range keys {
+		e.Logger.Subprocess("Adding %s to ssh-agent", key.path)
+
+		err = os.Remove(askPassOncePath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		var stderr bytes.Buffer
+		cmd := exec.Command("ssh-add", key.path)
+		cmd.Env = append(env, sshPassphraseEnv+"="+key.passphrase, sshAskPassOnceEnv+"="+askPassOncePath)
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		if err != nil {
+			return fmt.Errorf("failed to add %s to ssh-agent: %w: %s", key.path, err, strings.TrimSpace(Redact(stderr.String(), key.passphrase)))
+		}
+
+		cmd = exec.Command("ssh-add", "-L")
+		cmd.Env = env
+		output, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("failed to list keys of ssh-agent: %w", err)
+		}
+
+		publicKey := ""
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			if !listed[line] {
+				listed[line] = true
+				publicKey = line
+			}
+		}
+
+		if publicKey != "" {
+			err = ioutil.WriteFile(key.path+".pub", []byte(publicKey+"\n"), 0600)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// StopSSHAgent stops the ssh-agent started for the gitcredentials layer at
+// layerPath, if any, and removes its socket
+func StopSSHAgent(layerPath string) error {
+	sshDir := filepath.Join(layerPath, SSHDirName)
+	pidPath := filepath.Join(sshDir, SSHAgentPIDFileName)
+
+	pid, err := ioutil.ReadFile(pidPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("ssh-agent", "-k")
+	cmd.Env = append(os.Environ(), "SSH_AGENT_PID="+strings.TrimSpace(string(pid)))
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to stop ssh-agent: %w", err)
+	}
+
+	for _, path := range []string{pidPath, filepath.Join(sshDir, SSHAgentSocketName)} {
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,268 @@
+package git_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testSSH(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		layerDir string
+		env      git.BuildEnvironment
+	)
+
+	it.Before(func() {
+		var err error
+		layerDir, err = ioutil.TempDir("", "layer")
+		Expect(err).NotTo(HaveOccurred())
+
+		env = git.BuildEnvironment{
+			Logger: scribe.NewLogger(os.Stdout),
+			BuildPackYML: git.BuildPackYML{
+				Credentials: []git.GitCredential{
+					{Protocol: "https", Host: "github.com", Path: "/", Username: "user", Password: "token"},
+					{Protocol: "ssh", Host: "gitlab.com", Username: "git", SSHKey: "key-1", KnownHosts: "gitlab.com ssh-ed25519 AAAA\n"},
+					{Protocol: "ssh", Host: "git@gitlab.com:2222", SSHKey: "key-2\n"},
+					{Protocol: "ssh", Host: "example.com", SSHKey: "key-3"},
+				},
+			},
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(layerDir)).To(Succeed())
+		_ = exec.Command("git", "config", "--global", "--unset", "core.sshCommand").Run()
+	})
+
+	it("detects SSH credentials", func() {
+		Expect(env.HasSSHCredentials()).To(BeTrue())
+
+		env.BuildPackYML.Credentials = env.BuildPackYML.Credentials[:1]
+		Expect(env.HasSSHCredentials()).To(BeFalse())
+	})
+
+	it("writes keys, known hosts and an ssh_config and configures core.sshCommand", func() {
+		Expect(env.ConfigureSSH(layerDir)).To(Succeed())
+
+		sshDir := filepath.Join(layerDir, "ssh")
+		for i, key := range map[string]string{"id_1": "key-1\n", "id_2": "key-2\n", "id_3": "key-3\n"} {
+			content, err := ioutil.ReadFile(filepath.Join(sshDir, i))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal(key))
+
+			info, err := os.Stat(filepath.Join(sshDir, i))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		}
+
+		knownHosts, err := ioutil.ReadFile(filepath.Join(sshDir, "known_hosts"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(knownHosts)).To(Equal("gitlab.com ssh-ed25519 AAAA\n"))
+
+		sshConfig, err := ioutil.ReadFile(filepath.Join(sshDir, "ssh_config"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(sshConfig)).To(Equal(strings.ReplaceAll(`Host gitlab.com
+  HostName gitlab.com
+  User git
+  IdentityFile "SSHDIR/id_1"
+  IdentityFile "SSHDIR/id_2"
+  IdentitiesOnly yes
+  UserKnownHostsFile "SSHDIR/known_hosts"
+  StrictHostKeyChecking yes
+
+Host example.com
+  HostName example.com
+  IdentityFile "SSHDIR/id_3"
+  IdentitiesOnly yes
+  UserKnownHostsFile "SSHDIR/known_hosts"
+  StrictHostKeyChecking accept-new
+
+`, "SSHDIR", sshDir)))
+
+		output, err := exec.Command("git", "config", "--global", "core.sshCommand").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(Equal("ssh -F '" + filepath.Join(sshDir, "ssh_config") + "'\n"))
+	})
+
+	context("when SSH credentials are scoped to repositories", func() {
+		it.Before(func() {
+			env.BuildPackYML.Credentials = []git.GitCredential{
+				{Protocol: "ssh", Host: "github.com", Path: "/org/repo-a.git", SSHKey: "deploy-key-a", KnownHosts: "github.com ssh-ed25519 AAAA\n"},
+				{Protocol: "ssh", Host: "github.com", Path: "org/repo_b", Username: "deploy", SSHKey: "deploy-key-b"},
+				{Protocol: "ssh", Host: "github.com", SSHKey: "user-key"},
+			}
+		})
+
+		it.After(func() {
+			for _, url := range []string{"github.com-org-repo-a:org/repo-a", "github.com-org-repo-b:org/repo_b"} {
+				_ = exec.Command("git", "config", "--global", "--remove-section", "url."+url).Run()
+			}
+		})
+
+		it("generates a Host alias per repository and rewrites the repository URLs to it", func() {
+			Expect(env.ConfigureSSH(layerDir)).To(Succeed())
+
+			sshDir := filepath.Join(layerDir, "ssh")
+			sshConfig, err := ioutil.ReadFile(filepath.Join(sshDir, "ssh_config"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(sshConfig)).To(Equal(strings.ReplaceAll(`Host github.com-org-repo-a
+  HostName github.com
+  User git
+  IdentityFile "SSHDIR/id_0"
+  IdentitiesOnly yes
+  UserKnownHostsFile "SSHDIR/known_hosts"
+  StrictHostKeyChecking yes
+
+Host github.com-org-repo-b
+  HostName github.com
+  User deploy
+  IdentityFile "SSHDIR/id_1"
+  IdentitiesOnly yes
+  UserKnownHostsFile "SSHDIR/known_hosts"
+  StrictHostKeyChecking yes
+
+Host github.com
+  HostName github.com
+  IdentityFile "SSHDIR/id_2"
+  IdentitiesOnly yes
+  UserKnownHostsFile "SSHDIR/known_hosts"
+  StrictHostKeyChecking yes
+
+`, "SSHDIR", sshDir)))
+
+			output, err := exec.Command("git", "config", "--global", "--get-all", "url.github.com-org-repo-a:org/repo-a.insteadOf").Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(output)).To(Equal("git@github.com:org/repo-a\nssh://git@github.com/org/repo-a\n"))
+
+			output, err = exec.Command("git", "config", "--global", "--get-all", "url.github.com-org-repo-b:org/repo_b.insteadOf").Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(output)).To(Equal("deploy@github.com:org/repo_b\nssh://deploy@github.com/org/repo_b\ngit@github.com:org/repo_b\nssh://git@github.com/org/repo_b\n"))
+
+			output, err = exec.Command("git", "ls-remote", "--get-url", "git@github.com:org/repo_b.git").Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(output)).To(Equal("github.com-org-repo-b:org/repo_b.git\n"))
+		})
+
+		it("returns an error for conflicting keys of the same repository", func() {
+			env.BuildPackYML.Credentials = []git.GitCredential{
+				{Protocol: "ssh", Host: "github.com", Path: "/org/repo", SSHKey: "deploy-key-a"},
+				{Protocol: "ssh", Host: "github.com", SSHKey: "user-key"},
+				{Protocol: "ssh", Host: "git@github.com", Path: "org/repo.git", SSHKey: "deploy-key-b"},
+			}
+
+			err := env.ConfigureSSH(layerDir)
+			Expect(err).To(MatchError("SSH credentials #1 and #3 conflict: both specify a key for github.com:org/repo"))
+		})
+
+		it("keeps the keys of repositories whose aliases collide", func() {
+			env.BuildPackYML.Credentials = []git.GitCredential{
+				{Protocol: "ssh", Host: "github.com", Path: "/org/repo", SSHKey: "deploy-key-a"},
+				{Protocol: "ssh", Host: "github.com", Path: "/org-repo", SSHKey: "deploy-key-b"},
+			}
+			defer func() {
+				output, _ := exec.Command("git", "config", "--global", "--name-only", "--get-regexp", `^url\.github\.com-org-repo`).Output()
+				for _, key := range strings.Fields(string(output)) {
+					_ = exec.Command("git", "config", "--global", "--unset-all", key).Run()
+				}
+			}()
+
+			Expect(env.ConfigureSSH(layerDir)).To(Succeed())
+
+			sshDir := filepath.Join(layerDir, "ssh")
+			sshConfig, err := ioutil.ReadFile(filepath.Join(sshDir, "ssh_config"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(sshConfig)).To(ContainSubstring("Host github.com-org-repo\n"))
+			Expect(string(sshConfig)).To(MatchRegexp(`Host github.com-org-repo-[0-9a-f]{8}\n  HostName github.com\n  User git\n  IdentityFile ".*/id_1"`))
+
+			output, err := exec.Command("git", "config", "--global", "--get-regexp", `^url\.github\.com-org-repo-[0-9a-f]{8}:org-repo\.insteadof$`).Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(output)).To(ContainSubstring("git@github.com:org-repo"))
+		})
+	})
+
+	context("when SSH keys are encrypted", func() {
+		var keyDir string
+
+		it.Before(func() {
+			var err error
+			keyDir, err = ioutil.TempDir("", "keys")
+			Expect(err).NotTo(HaveOccurred())
+
+			keyPath := filepath.Join(keyDir, "id_ed25519")
+			output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "s3cr3t passphrase", "-C", "encrypted", "-f", keyPath).CombinedOutput()
+			Expect(err).NotTo(HaveOccurred(), string(output))
+
+			key, err := ioutil.ReadFile(keyPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			os.Setenv("TEST_SSH_PASSPHRASE", "s3cr3t passphrase")
+			env.BuildPackYML.Credentials = []git.GitCredential{
+				{Protocol: "ssh", Host: "github.com", Username: "git", SSHKey: string(key), PassphraseEnv: "TEST_SSH_PASSPHRASE"},
+			}
+		})
+
+		it.After(func() {
+			Expect(git.StopSSHAgent(layerDir)).To(Succeed())
+			Expect(os.RemoveAll(keyDir)).To(Succeed())
+			os.Unsetenv("TEST_SSH_PASSPHRASE")
+		})
+
+		it("loads them into a dedicated ssh-agent and stops it again", func() {
+			Expect(env.HasSSHPassphrases()).To(BeTrue())
+			Expect(env.ConfigureSSH(layerDir)).To(Succeed())
+
+			sshDir := filepath.Join(layerDir, "ssh")
+			socketPath := filepath.Join(sshDir, "agent.sock")
+
+			cmd := exec.Command("ssh-add", "-l")
+			cmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+socketPath)
+			output, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(output)).To(ContainSubstring("encrypted (ED25519)"))
+
+			publicKey, err := ioutil.ReadFile(filepath.Join(sshDir, "id_0.pub"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(publicKey)).To(HavePrefix("ssh-ed25519 "))
+
+			sshConfig, err := ioutil.ReadFile(filepath.Join(sshDir, "ssh_config"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(sshConfig)).To(ContainSubstring("  IdentityAgent \"" + socketPath + "\"\n"))
+
+			Expect(git.StopSSHAgent(layerDir)).To(Succeed())
+			Expect(socketPath).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(sshDir, "agent.pid")).NotTo(BeAnExistingFile())
+		})
+
+		it("fails for a wrong passphrase", func() {
+			os.Setenv("TEST_SSH_PASSPHRASE", "wrong")
+
+			err := env.ConfigureSSH(layerDir)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("failed to add " + filepath.Join(layerDir, "ssh", "id_0") + " to ssh-agent"))
+		})
+
+		it("fails if the passphrase environment variable is not set", func() {
+			os.Unsetenv("TEST_SSH_PASSPHRASE")
+
+			Expect(env.ConfigureSSH(layerDir)).To(MatchError("SSH credential #1: environment variable TEST_SSH_PASSPHRASE is not set"))
+		})
+	})
+
+	it("returns an error for SSH credentials without a host", func() {
+		env.BuildPackYML.Credentials = []git.GitCredential{{SSHKey: "key"}}
+
+		Expect(env.ConfigureSSH(layerDir)).To(MatchError("SSH credential #1 does not specify a host"))
+	})
+}
@@ -0,0 +1,219 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultTektonCredsDir is the directory Tekton writes the credentials of
+// annotated secrets to. It can be overridden with GIT_CREDENTIALS_TEKTON_DIR.
+const DefaultTektonCredsDir = "/tekton/creds"
+
+// ReadTektonCredentials reads the credentials Tekton's credential initializer
+// writes to its creds directory: a .git-credentials file in the format of
+// "git credential-store", a .gitconfig declaring the credential contexts and
+// SSH keys referenced by .ssh/config
+func ReadTektonCredentials(dir string) ([]GitCredential, error) {
+	var credentials []GitCredential
+
+	storePath := filepath.Join(dir, ".git-credentials")
+	if _, err := os.Stat(storePath); err == nil {
+		storeCredentials, err := ReadCredentialStoreFile(storePath)
+		if err != nil {
+			return nil, err
+		}
+
+		contexts, err := readCredentialContexts(filepath.Join(dir, ".gitconfig"))
+		if err != nil {
+			return nil, err
+		}
+
+		for i, credential := range storeCredentials {
+			// .git-credentials only contains hosts, the credential contexts in
+			// .gitconfig may narrow them down to a path
+			for _, context := range contexts {
+				if context.Scheme == credential.Protocol && context.Host == credential.Host && context.Path != "" {
+					storeCredentials[i].Path = context.Path
+				}
+			}
+		}
+
+		credentials = append(credentials, storeCredentials...)
+	}
+
+	sshConfigPath := filepath.Join(dir, ".ssh", "config")
+	if _, err := os.Stat(sshConfigPath); err == nil {
+		sshCredentials, err := readTektonSSHCredentials(dir)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, sshCredentials...)
+	}
+
+	return credentials, nil
+}
+
+// readCredentialContexts returns the URLs of all [credential "<url>"] sections
+// of a gitconfig file
+func readCredentialContexts(path string) ([]*url.URL, error) {
+	sections, err := parseGitConfig(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var contexts []*url.URL
+	for _, section := range sections {
+		name, subsection, found := strings.Cut(section, " ")
+		if !found || name != "credential" {
+			continue
+		}
+
+		context, err := url.Parse(strings.Trim(subsection, `"`))
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential context in %s: %w", path, err)
+		}
+		contexts = append(contexts, context)
+	}
+
+	return contexts, nil
+}
+
+// parseGitConfig returns the section headers of a gitconfig file, e.g.
+// `credential "https://github.com"`
+func parseGitConfig(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sections []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			sections = append(sections, strings.TrimSpace(line[1:len(line)-1]))
+		}
+	}
+
+	return sections, scanner.Err()
+}
+
+// readTektonSSHCredentials maps every "Host" of Tekton's .ssh/config to an
+// SSH credential using the key given by "IdentityFile"
+func readTektonSSHCredentials(dir string) ([]GitCredential, error) {
+	sshDir := filepath.Join(dir, ".ssh")
+
+	hosts, err := parseSSHConfig(filepath.Join(sshDir, "config"))
+	if err != nil {
+		return nil, err
+	}
+
+	var knownHosts string
+	content, err := ioutil.ReadFile(filepath.Join(sshDir, "known_hosts"))
+	if err == nil {
+		knownHosts = string(content)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var credentials []GitCredential
+	for _, host := range hosts {
+		if host.identityFile == "" {
+			continue
+		}
+
+		key, err := ioutil.ReadFile(tektonIdentityFile(sshDir, host.identityFile))
+		if err != nil {
+			return nil, err
+		}
+
+		hostName := host.hostName
+		if hostName == "" {
+			hostName = host.host
+		}
+
+		credentials = append(credentials, GitCredential{
+			Protocol:   "ssh",
+			Host:       hostName,
+			Username:   host.user,
+			SSHKey:     string(key),
+			KnownHosts: knownHosts,
+		})
+	}
+
+	return credentials, nil
+}
+
+// tektonIdentityFile resolves an IdentityFile of Tekton's .ssh/config. Tekton
+// references keys relative to the home directory the creds directory is
+// copied to, so keys are looked up in the creds directory instead.
+func tektonIdentityFile(sshDir string, identityFile string) string {
+	if strings.HasPrefix(identityFile, "~/.ssh/") {
+		return filepath.Join(sshDir, strings.TrimPrefix(identityFile, "~/.ssh/"))
+	}
+
+	if _, err := os.Stat(identityFile); err != nil {
+		return filepath.Join(sshDir, filepath.Base(identityFile))
+	}
+
+	return identityFile
+}
+
+// sshConfigHost represents a "Host" block of an ssh_config file
+type sshConfigHost struct {
+	host         string
+	hostName     string
+	user         string
+	identityFile string
+}
+
+// parseSSHConfig parses the "Host" blocks of an ssh_config file
+func parseSSHConfig(path string) ([]sshConfigHost, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var hosts []sshConfigHost
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(strings.Replace(line, "=", " ", 1))
+		if len(fields) < 2 {
+			continue
+		}
+		value := strings.Trim(strings.Join(fields[1:], " "), `"`)
+
+		switch strings.ToLower(fields[0]) {
+		case "host":
+			hosts = append(hosts, sshConfigHost{host: value})
+		case "hostname":
+			if len(hosts) > 0 {
+				hosts[len(hosts)-1].hostName = value
+			}
+		case "user":
+			if len(hosts) > 0 {
+				hosts[len(hosts)-1].user = value
+			}
+		case "identityfile":
+			if len(hosts) > 0 && hosts[len(hosts)-1].identityFile == "" {
+				hosts[len(hosts)-1].identityFile = value
+			}
+		}
+	}
+
+	return hosts, scanner.Err()
+}
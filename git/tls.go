@@ -0,0 +1,225 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// TLSDirName is the name of the directory within the gitcredentials layer
+	// containing CA bundles, client certificates and keys
+	TLSDirName = "tls"
+
+	// CACertificatesBindingType is the type of service bindings containing CA
+	// certificates
+	CACertificatesBindingType = "ca-certificates"
+)
+
+// TLSConfig represents the CA bundle and client certificate used for a
+// credential. Each of them is either given inline as PEM or as path to a file,
+// relative paths are resolved against the app directory.
+type TLSConfig struct {
+	CACert         string `yaml:"ca_cert" json:"ca_cert"`
+	CACertFile     string `yaml:"ca_cert_file" json:"ca_cert_file"`
+	ClientCert     string `yaml:"client_cert" json:"client_cert"`
+	ClientCertFile string `yaml:"client_cert_file" json:"client_cert_file"`
+	ClientKey      string `yaml:"client_key" json:"client_key"`
+	ClientKeyFile  string `yaml:"client_key_file" json:"client_key_file"`
+
+	// Binding is the name of a service binding of type ca-certificates. Its
+	// tls.crt and tls.key entries are used as client certificate and key, all
+	// other entries are added to the CA bundle.
+	Binding string `yaml:"binding" json:"binding"`
+}
+
+// HasTLSConfig reports whether any credential specifies a TLS configuration
+func (e BuildEnvironment) HasTLSConfig() bool {
+	for _, credential := range e.BuildPackYML.Credentials {
+		if credential.TLS != nil && !credential.IsSSH() {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigureTLS writes the CA bundles, client certificates and keys of all
+// credentials into the given layer directory and directs GIT to use them via
+// http.<url>.sslCAInfo, http.<url>.sslCert and http.<url>.sslKey
+func (e BuildEnvironment) ConfigureTLS(layerPath string) error {
+	e.Logger.Process("Configuring git to use CA certificates and client certificates")
+
+	tlsDir := filepath.Join(layerPath, TLSDirName)
+	err := os.MkdirAll(tlsDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	for i, credential := range e.BuildPackYML.Credentials {
+		if credential.TLS == nil || credential.IsSSH() {
+			continue
+		}
+
+		files, err := e.resolveTLSFiles(*credential.TLS)
+		if err != nil {
+			return fmt.Errorf("invalid TLS configuration of credential #%d: %w", i+1, err)
+		}
+
+		credentialURL := credential.configURL()
+		for _, file := range []struct {
+			content string
+			name    string
+			key     string
+		}{
+			{files.caCert, fmt.Sprintf("ca_%d.pem", i), "sslCAInfo"},
+			{files.clientCert, fmt.Sprintf("cert_%d.pem", i), "sslCert"},
+			{files.clientKey, fmt.Sprintf("key_%d.pem", i), "sslKey"},
+		} {
+			if file.content == "" {
+				continue
+			}
+
+			path := filepath.Join(tlsDir, file.name)
+			err = ioutil.WriteFile(path, []byte(file.content), 0600)
+			if err != nil {
+				return err
+			}
+
+			err = e.RunGitCommand([]string{
+				"git",
+				"config",
+				"--global",
+				"http." + credentialURL + "." + file.key,
+				path,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// tlsFiles holds the PEM contents of a TLS configuration
+type tlsFiles struct {
+	caCert     string
+	clientCert string
+	clientKey  string
+}
+
+// resolveTLSFiles reads the inline values, files and binding of a TLS
+// configuration
+func (e BuildEnvironment) resolveTLSFiles(config TLSConfig) (tlsFiles, error) {
+	var (
+		files tlsFiles
+		err   error
+	)
+
+	files.caCert, err = e.inlineOrFile("ca_cert", config.CACert, config.CACertFile)
+	if err != nil {
+		return tlsFiles{}, err
+	}
+
+	files.clientCert, err = e.inlineOrFile("client_cert", config.ClientCert, config.ClientCertFile)
+	if err != nil {
+		return tlsFiles{}, err
+	}
+
+	files.clientKey, err = e.inlineOrFile("client_key", config.ClientKey, config.ClientKeyFile)
+	if err != nil {
+		return tlsFiles{}, err
+	}
+
+	if config.Binding != "" {
+		bindings, err := ResolveBindings(CACertificatesBindingType, e.Context.Platform.Path)
+		if err != nil {
+			return tlsFiles{}, err
+		}
+
+		found := false
+		for _, binding := range bindings {
+			if binding.Name != config.Binding {
+				continue
+			}
+			found = true
+
+			var names []string
+			for name := range binding.Entries {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				content, err := binding.Entries[name].ReadString()
+				if err != nil {
+					return tlsFiles{}, err
+				}
+
+				switch name {
+				case "tls.crt":
+					if files.clientCert == "" {
+						files.clientCert = pemBlock(content)
+					}
+				case "tls.key":
+					if files.clientKey == "" {
+						files.clientKey = pemBlock(content)
+					}
+				default:
+					files.caCert += pemBlock(content)
+				}
+			}
+		}
+
+		if !found {
+			return tlsFiles{}, fmt.Errorf("no service binding %q of type %s found", config.Binding, CACertificatesBindingType)
+		}
+	}
+
+	if files.clientKey != "" && files.clientCert == "" {
+		return tlsFiles{}, errors.New("client_key requires a client_cert")
+	}
+
+	return files, nil
+}
+
+// inlineOrFile returns the inline value or the contents of the file of a TLS
+// setting
+func (e BuildEnvironment) inlineOrFile(name string, inline string, path string) (string, error) {
+	if inline != "" && path != "" {
+		return "", fmt.Errorf("only one of %s and %s_file may be specified", name, name)
+	}
+
+	if inline != "" {
+		return pemBlock(inline), nil
+	}
+
+	if path == "" {
+		return "", nil
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(e.Context.WorkingDir, path)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return pemBlock(string(content)), nil
+}
+
+// pemBlock ensures PEM data ends with a newline, so that blocks can be
+// concatenated
+func pemBlock(content string) string {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return ""
+	}
+	return content + "\n"
+}
@@ -0,0 +1,142 @@
+package git_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testTLS(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		layerDir    string
+		workingDir  string
+		platformDir string
+		env         git.BuildEnvironment
+	)
+
+	gitConfig := func(key string) string {
+		output, err := exec.Command("git", "config", "--global", key).Output()
+		Expect(err).NotTo(HaveOccurred())
+		return strings.TrimSpace(string(output))
+	}
+
+	it.Before(func() {
+		var err error
+		layerDir, err = ioutil.TempDir("", "layer")
+		Expect(err).NotTo(HaveOccurred())
+
+		workingDir, err = ioutil.TempDir("", "workingDir")
+		Expect(err).NotTo(HaveOccurred())
+
+		platformDir, err = ioutil.TempDir("", "platform")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(workingDir, "certs"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(workingDir, "certs", "client.pem"), []byte("CLIENT CERT"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(workingDir, "certs", "client.key"), []byte("CLIENT KEY\n"), 0600)).To(Succeed())
+
+		bindingDir := filepath.Join(platformDir, "bindings", "internal-ca")
+		Expect(os.MkdirAll(bindingDir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(bindingDir, "type"), []byte("ca-certificates"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(bindingDir, "root.pem"), []byte("ROOT CA"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(bindingDir, "intermediate.pem"), []byte("INTERMEDIATE CA"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(bindingDir, "tls.crt"), []byte("BINDING CERT"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(bindingDir, "tls.key"), []byte("BINDING KEY"), 0600)).To(Succeed())
+
+		env = git.BuildEnvironment{
+			Logger: scribe.NewLogger(ioutil.Discard),
+			Context: packit.BuildContext{
+				WorkingDir: workingDir,
+				Platform:   packit.Platform{Path: platformDir},
+			},
+			BuildPackYML: git.BuildPackYML{
+				Credentials: []git.GitCredential{
+					{Protocol: "https", Host: "github.com", Path: "/", Username: "user", Password: "token"},
+					{
+						Protocol: "https", Host: "git.example.com", Path: "/", Username: "user", Password: "token",
+						TLS: &git.TLSConfig{CACert: "EXAMPLE CA", ClientCertFile: "certs/client.pem", ClientKeyFile: "certs/client.key"},
+					},
+					{
+						Protocol: "https", Host: "git.example.org", Path: "/team/", Username: "user", Password: "token",
+						TLS: &git.TLSConfig{Binding: "internal-ca"},
+					},
+				},
+			},
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(layerDir)).To(Succeed())
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+		Expect(os.RemoveAll(platformDir)).To(Succeed())
+		for _, url := range []string{"https://git.example.com/", "https://git.example.org/team/"} {
+			_ = exec.Command("git", "config", "--global", "--remove-section", "http."+url).Run()
+		}
+	})
+
+	it("detects TLS configurations", func() {
+		Expect(env.HasTLSConfig()).To(BeTrue())
+
+		env.BuildPackYML.Credentials = env.BuildPackYML.Credentials[:1]
+		Expect(env.HasTLSConfig()).To(BeFalse())
+	})
+
+	it("writes CA bundles, client certificates and keys and configures them per URL", func() {
+		Expect(env.ConfigureTLS(layerDir)).To(Succeed())
+
+		tlsDir := filepath.Join(layerDir, "tls")
+		info, err := os.Stat(tlsDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0700)))
+
+		for name, content := range map[string]string{
+			"ca_1.pem":   "EXAMPLE CA\n",
+			"cert_1.pem": "CLIENT CERT\n",
+			"key_1.pem":  "CLIENT KEY\n",
+			"ca_2.pem":   "INTERMEDIATE CA\nROOT CA\n",
+			"cert_2.pem": "BINDING CERT\n",
+			"key_2.pem":  "BINDING KEY\n",
+		} {
+			path := filepath.Join(tlsDir, name)
+			actual, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(actual)).To(Equal(content))
+
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		}
+
+		Expect(gitConfig("http.https://git.example.com/.sslCAInfo")).To(Equal(filepath.Join(tlsDir, "ca_1.pem")))
+		Expect(gitConfig("http.https://git.example.com/.sslCert")).To(Equal(filepath.Join(tlsDir, "cert_1.pem")))
+		Expect(gitConfig("http.https://git.example.com/.sslKey")).To(Equal(filepath.Join(tlsDir, "key_1.pem")))
+		Expect(gitConfig("http.https://git.example.org/team/.sslCAInfo")).To(Equal(filepath.Join(tlsDir, "ca_2.pem")))
+	})
+
+	it("rejects inline values together with files", func() {
+		env.BuildPackYML.Credentials[1].TLS.CACertFile = "certs/ca.pem"
+		Expect(env.ConfigureTLS(layerDir)).To(MatchError("invalid TLS configuration of credential #2: only one of ca_cert and ca_cert_file may be specified"))
+	})
+
+	it("rejects a client key without a client certificate", func() {
+		env.BuildPackYML.Credentials[1].TLS.ClientCertFile = ""
+		Expect(env.ConfigureTLS(layerDir)).To(MatchError("invalid TLS configuration of credential #2: client_key requires a client_cert"))
+	})
+
+	it("fails if the binding does not exist", func() {
+		env.BuildPackYML.Credentials[2].TLS.Binding = "missing"
+		Expect(env.ConfigureTLS(layerDir)).To(MatchError(`invalid TLS configuration of credential #3: no service binding "missing" of type ca-certificates found`))
+	})
+}
@@ -0,0 +1,80 @@
+package git
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// IsMinted reports whether the password of a credential is minted and
+// therefore expires: GitHub App installation tokens after one hour, access
+// tokens of an OIDC exchange as the token endpoint decides and signed
+// CodeCommit passwords after 15 minutes
+func (c GitCredential) IsMinted() bool {
+	return c.GitHubApp != nil || c.OIDCExchange != nil || c.CodeCommit != nil
+}
+
+// HasMintedCredentials reports whether the password of any credential is
+// minted
+func (e BuildEnvironment) HasMintedCredentials() bool {
+	for _, credential := range e.BuildPackYML.Credentials {
+		if credential.IsMinted() {
+			return true
+		}
+	}
+	return false
+}
+
+// MintTokens replaces the passwords of credentials which are minted at build
+// time, i.e. GitHub App installation tokens, access tokens obtained by
+// exchanging OIDC ID tokens and signed CodeCommit passwords. Minted
+// credentials are returned with their defaults applied, all others unchanged.
+func MintTokens(credentials []GitCredential, logger scribe.Logger) ([]GitCredential, error) {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+
+	minted := make([]GitCredential, 0, len(credentials))
+	for _, credential := range credentials {
+		if credential.CodeCommit != nil {
+			logger.Process("Signing CodeCommit credentials for %s", CodeCommitHost(credential.CodeCommit.Region))
+			codeCommitCredentials, err := CodeCommitCredentials(*credential.CodeCommit, time.Now())
+			if err != nil {
+				return nil, err
+			}
+
+			minted = append(minted, codeCommitCredentials...)
+			continue
+		}
+
+		if credential.GitHubApp != nil {
+			logger.Process("Minting GitHub App installation token for %s (app %s, installation %s)", credential.Host, credential.GitHubApp.AppID, credential.GitHubApp.InstallationID)
+			token, err := MintGitHubAppToken(*credential.GitHubApp, httpClient)
+			if err != nil {
+				return nil, err
+			}
+
+			credential.Username = GitHubAppUsername
+			credential.Password = token
+			credential = credential.WithDefaults()
+		}
+
+		if credential.OIDCExchange != nil {
+			logger.Process("Exchanging OIDC ID token for an access token for %s", credential.Host)
+			token, err := ExchangeOIDCToken(*credential.OIDCExchange, httpClient)
+			if err != nil {
+				return nil, err
+			}
+
+			credential.Username = credential.OIDCExchange.Username
+			if credential.Username == "" {
+				credential.Username = DefaultOIDCTokenUsername
+			}
+			credential.Password = token
+			credential = credential.WithDefaults()
+		}
+
+		minted = append(minted, credential)
+	}
+
+	return minted, nil
+}
@@ -0,0 +1,349 @@
+package git
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// VaultBindingType is the type of service bindings configuring access to
+// HashiCorp Vault
+const VaultBindingType = "vault"
+
+// VaultConfig configures reading credentials from the KV v2 secrets engine of
+// HashiCorp Vault. Token, RoleID and SecretID are secrets and can only be
+// supplied via environment variables or a service binding.
+type VaultConfig struct {
+	Address    string   `yaml:"address"`
+	Namespace  string   `yaml:"namespace"`
+	Mount      string   `yaml:"mount"`
+	Paths      []string `yaml:"paths"`
+	CACert     string   `yaml:"ca_cert"`
+	AuthMethod string   `yaml:"auth_method"`
+
+	Token    string `yaml:"-"`
+	RoleID   string `yaml:"-"`
+	SecretID string `yaml:"-"`
+
+	// CACertPEM holds the contents of CACert or of the "ca.crt" binding entry
+	CACertPEM []byte `yaml:"-"`
+}
+
+// ResolveVaultConfig completes the Vault configuration of the buildpack.yml
+// with a service binding of type "vault" and the environment variables
+// VAULT_ADDR, VAULT_NAMESPACE, VAULT_CACERT, VAULT_TOKEN, VAULT_ROLE_ID,
+// VAULT_SECRET_ID, GIT_CREDENTIALS_VAULT_MOUNT and GIT_CREDENTIALS_VAULT_PATHS
+// (comma separated). Environment variables take precedence over the binding,
+// the binding takes precedence over the buildpack.yml.
+func ResolveVaultConfig(config VaultConfig, workingDir string, platformPath string) (VaultConfig, error) {
+	bindings, err := ResolveBindings(VaultBindingType, platformPath)
+	if err != nil {
+		return VaultConfig{}, err
+	}
+
+	if len(bindings) > 1 {
+		return VaultConfig{}, fmt.Errorf("found %d service bindings of type %s but expected at most 1", len(bindings), VaultBindingType)
+	}
+
+	if len(bindings) == 1 {
+		fields := map[string]*string{
+			"address":     &config.Address,
+			"namespace":   &config.Namespace,
+			"mount":       &config.Mount,
+			"auth-method": &config.AuthMethod,
+			"token":       &config.Token,
+			"role-id":     &config.RoleID,
+			"secret-id":   &config.SecretID,
+		}
+		for name, field := range fields {
+			value, ok, err := bindingEntry(bindings[0], name)
+			if err != nil {
+				return VaultConfig{}, err
+			}
+			if ok {
+				*field = value
+			}
+		}
+
+		paths, ok, err := bindingEntry(bindings[0], "paths")
+		if err != nil {
+			return VaultConfig{}, err
+		}
+		if ok {
+			config.Paths = strings.Fields(paths)
+		}
+
+		caCert, ok, err := bindingEntry(bindings[0], "ca.crt")
+		if err != nil {
+			return VaultConfig{}, err
+		}
+		if ok {
+			config.CACertPEM = []byte(caCert)
+		}
+	}
+
+	envFields := map[string]*string{
+		"VAULT_ADDR":                  &config.Address,
+		"VAULT_NAMESPACE":             &config.Namespace,
+		"VAULT_CACERT":                &config.CACert,
+		"VAULT_TOKEN":                 &config.Token,
+		"VAULT_ROLE_ID":               &config.RoleID,
+		"VAULT_SECRET_ID":             &config.SecretID,
+		"GIT_CREDENTIALS_VAULT_MOUNT": &config.Mount,
+	}
+	for name, field := range envFields {
+		value, exists := os.LookupEnv(name)
+		if exists && len(value) > 0 {
+			*field = value
+		}
+	}
+
+	gitVaultPaths, pathsExists := os.LookupEnv("GIT_CREDENTIALS_VAULT_PATHS")
+	if pathsExists && len(gitVaultPaths) > 0 {
+		config.Paths = strings.Split(gitVaultPaths, ",")
+	}
+
+	if config.Mount == "" {
+		config.Mount = "secret"
+	}
+
+	if config.CACert != "" {
+		caCertPath := config.CACert
+		if !filepath.IsAbs(caCertPath) {
+			caCertPath = filepath.Join(workingDir, caCertPath)
+		}
+
+		config.CACertPEM, err = ioutil.ReadFile(caCertPath)
+		if err != nil {
+			return VaultConfig{}, fmt.Errorf("failed to read Vault CA certificate: %w", err)
+		}
+	}
+
+	return config, nil
+}
+
+// Enabled reports whether credentials should be read from Vault
+func (c VaultConfig) Enabled() bool {
+	return len(c.Paths) > 0
+}
+
+// VaultClient reads credentials from the KV v2 secrets engine of HashiCorp
+// Vault
+type VaultClient struct {
+	Config     VaultConfig
+	HTTPClient *http.Client
+}
+
+// NewVaultClient creates a VaultClient for the given configuration
+func NewVaultClient(config VaultConfig) (VaultClient, error) {
+	if config.Address == "" {
+		return VaultClient{}, fmt.Errorf("no Vault address configured")
+	}
+
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		rootCAs = x509.NewCertPool()
+	}
+
+	if len(config.CACertPEM) > 0 && !rootCAs.AppendCertsFromPEM(config.CACertPEM) {
+		return VaultClient{}, fmt.Errorf("Vault CA certificate does not contain any PEM encoded certificates")
+	}
+
+	config.Address = strings.TrimSuffix(config.Address, "/")
+
+	return VaultClient{
+		Config: config,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs:    rootCAs,
+					MinVersion: tls.VersionTLS12,
+				},
+			},
+		},
+	}, nil
+}
+
+// ReadCredentials authenticates against Vault and reads the credentials stored
+// in all configured secrets. A secret either contains the fields of a single
+// credential or a list of credentials in a field named "credentials" (as array
+// or as JSON encoded string).
+func (c VaultClient) ReadCredentials() ([]GitCredential, error) {
+	token, err := c.login()
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials []GitCredential
+	for _, path := range c.Config.Paths {
+		path = strings.Trim(strings.TrimSpace(path), "/")
+		if path == "" {
+			continue
+		}
+
+		var secret struct {
+			Data struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"data"`
+		}
+
+		err = c.request(http.MethodGet, "/v1/"+strings.Trim(c.Config.Mount, "/")+"/data/"+path, token, nil, &secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Vault secret %s: %w", path, err)
+		}
+
+		secretCredentials, err := vaultSecretCredentials(secret.Data.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Vault secret %s: %w", path, err)
+		}
+
+		for i, credential := range secretCredentials {
+			if credential.Host == "" && credential.URL == "" && credential.Provider == "" {
+				return nil, fmt.Errorf("credential #%d of Vault secret %s does not specify a host", i+1, path)
+			}
+			credentials = append(credentials, credential.WithDefaults())
+		}
+	}
+
+	return credentials, nil
+}
+
+// login returns the token used to read secrets
+func (c VaultClient) login() (string, error) {
+	authMethod := c.Config.AuthMethod
+	if authMethod == "" {
+		authMethod = "token"
+		if c.Config.Token == "" && c.Config.RoleID != "" {
+			authMethod = "approle"
+		}
+	}
+
+	switch authMethod {
+	case "token":
+		if c.Config.Token == "" {
+			return "", fmt.Errorf("Vault auth method token requires VAULT_TOKEN")
+		}
+		return c.Config.Token, nil
+
+	case "approle":
+		if c.Config.RoleID == "" || c.Config.SecretID == "" {
+			return "", fmt.Errorf("Vault auth method approle requires VAULT_ROLE_ID and VAULT_SECRET_ID")
+		}
+
+		body, err := json.Marshal(map[string]string{
+			"role_id":   c.Config.RoleID,
+			"secret_id": c.Config.SecretID,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		var login struct {
+			Auth struct {
+				ClientToken string `json:"client_token"`
+			} `json:"auth"`
+		}
+
+		err = c.request(http.MethodPost, "/v1/auth/approle/login", "", body, &login)
+		if err != nil {
+			return "", fmt.Errorf("failed to log in to Vault with AppRole: %w", err)
+		}
+
+		if login.Auth.ClientToken == "" {
+			return "", fmt.Errorf("failed to log in to Vault with AppRole: no client token returned")
+		}
+		return login.Auth.ClientToken, nil
+
+	default:
+		return "", fmt.Errorf("unsupported Vault auth method %q, supported are token and approle", authMethod)
+	}
+}
+
+// request sends a request to the Vault API and decodes the response
+func (c VaultClient) request(method string, path string, token string, body []byte, result interface{}) error {
+	request, err := http.NewRequest(method, c.Config.Address+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if token != "" {
+		request.Header.Set("X-Vault-Token", token)
+	}
+	if c.Config.Namespace != "" {
+		request.Header.Set("X-Vault-Namespace", c.Config.Namespace)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var vaultError struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(responseBody, &vaultError) == nil && len(vaultError.Errors) > 0 {
+			return fmt.Errorf("Vault returned status %d: %s", response.StatusCode, strings.Join(vaultError.Errors, ", "))
+		}
+		return fmt.Errorf("Vault returned status %d", response.StatusCode)
+	}
+
+	return json.Unmarshal(responseBody, result)
+}
+
+// vaultSecretCredentials maps the data of a KV v2 secret to credentials
+func vaultSecretCredentials(data map[string]interface{}) ([]GitCredential, error) {
+	if list, ok := data["credentials"]; ok {
+		if encoded, ok := list.(string); ok {
+			var credentials []GitCredential
+			err := json.Unmarshal([]byte(encoded), &credentials)
+			if err != nil {
+				return nil, fmt.Errorf("field credentials is not a JSON encoded list of credentials")
+			}
+			return credentials, nil
+		}
+
+		encoded, err := json.Marshal(list)
+		if err != nil {
+			return nil, err
+		}
+
+		var credentials []GitCredential
+		err = json.Unmarshal(encoded, &credentials)
+		if err != nil {
+			return nil, fmt.Errorf("field credentials is not a list of credentials")
+		}
+		return credentials, nil
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var credential GitCredential
+	err = json.Unmarshal(encoded, &credential)
+	if err != nil {
+		return nil, fmt.Errorf("secret does not contain a credential")
+	}
+
+	return []GitCredential{credential}, nil
+}
@@ -0,0 +1,249 @@
+package git_test
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testVault(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		server     *httptest.Server
+		caCertPEM  []byte
+		namespaces []string
+	)
+
+	it.Before(func() {
+		namespaces = nil
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			namespaces = append(namespaces, r.Header.Get("X-Vault-Namespace"))
+
+			if r.URL.Path == "/v1/auth/approle/login" {
+				var login map[string]string
+				_ = json.NewDecoder(r.Body).Decode(&login)
+				if login["role_id"] != "role" || login["secret_id"] != "secret" {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"errors": ["invalid role or secret ID"]}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"auth": {"client_token": "approle-token"}}`))
+				return
+			}
+
+			token := r.Header.Get("X-Vault-Token")
+			if token != "root-token" && token != "approle-token" {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors": ["permission denied"]}`))
+				return
+			}
+
+			switch r.URL.Path {
+			case "/v1/kv/data/git/github":
+				_, _ = w.Write([]byte(`{"data": {"data": {"host": "github.com", "username": "user", "password": "token"}, "metadata": {"version": 1}}}`))
+			case "/v1/kv/data/git/list":
+				_, _ = w.Write([]byte(`{"data": {"data": {"credentials": [{"host": "gitlab.com", "path": "/group", "username": "a", "password": "b"}]}}}`))
+			case "/v1/kv/data/git/encoded":
+				_, _ = w.Write([]byte(`{"data": {"data": {"credentials": "[{\"protocol\": \"https\", \"host\": \"example.com\", \"username\": \"c\", \"password\": \"d\"}]"}}}`))
+			case "/v1/kv/data/git/hostless":
+				_, _ = w.Write([]byte(`{"data": {"data": {"username": "user", "password": "token"}}}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"errors": []}`))
+			}
+		}))
+
+		caCertPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	context("ResolveVaultConfig", func() {
+		var (
+			workingDir  string
+			platformDir string
+		)
+
+		it.Before(func() {
+			var err error
+			workingDir, err = ioutil.TempDir("", "working-dir")
+			Expect(err).NotTo(HaveOccurred())
+
+			platformDir, err = ioutil.TempDir("", "platform")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ioutil.WriteFile(filepath.Join(workingDir, "ca.pem"), caCertPEM, 0644)).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.RemoveAll(workingDir)).To(Succeed())
+			Expect(os.RemoveAll(platformDir)).To(Succeed())
+			os.Unsetenv("VAULT_TOKEN")
+			os.Unsetenv("GIT_CREDENTIALS_VAULT_PATHS")
+		})
+
+		it("is disabled without paths and defaults the mount", func() {
+			config, err := git.ResolveVaultConfig(git.VaultConfig{}, workingDir, platformDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Enabled()).To(BeFalse())
+			Expect(config.Mount).To(Equal("secret"))
+		})
+
+		it("merges the buildpack.yml, a binding and the environment", func() {
+			bindingDir := filepath.Join(platformDir, "bindings", "vault")
+			Expect(os.MkdirAll(bindingDir, 0755)).To(Succeed())
+			for name, content := range map[string]string{
+				"type":      "vault",
+				"address":   "https://vault.example.com",
+				"role-id":   "role",
+				"secret-id": "secret",
+				"paths":     "git/a\ngit/b\n",
+			} {
+				Expect(ioutil.WriteFile(filepath.Join(bindingDir, name), []byte(content), 0600)).To(Succeed())
+			}
+
+			os.Setenv("VAULT_TOKEN", "root-token")
+			os.Setenv("GIT_CREDENTIALS_VAULT_PATHS", "git/c,git/d")
+
+			config, err := git.ResolveVaultConfig(git.VaultConfig{
+				Address:   "https://ignored.example.com",
+				Namespace: "team",
+				Mount:     "kv",
+				CACert:    "ca.pem",
+			}, workingDir, platformDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(Equal(git.VaultConfig{
+				Address:   "https://vault.example.com",
+				Namespace: "team",
+				Mount:     "kv",
+				Paths:     []string{"git/c", "git/d"},
+				CACert:    "ca.pem",
+				Token:     "root-token",
+				RoleID:    "role",
+				SecretID:  "secret",
+				CACertPEM: caCertPEM,
+			}))
+		})
+
+		it("returns an error if the CA certificate cannot be read", func() {
+			_, err := git.ResolveVaultConfig(git.VaultConfig{CACert: "missing.pem"}, workingDir, platformDir)
+			Expect(err).To(MatchError(ContainSubstring("failed to read Vault CA certificate")))
+		})
+	})
+
+	context("ReadCredentials", func() {
+		var config git.VaultConfig
+
+		it.Before(func() {
+			config = git.VaultConfig{
+				Address:   server.URL,
+				Namespace: "team",
+				Mount:     "kv",
+				Paths:     []string{"git/github", "/git/list/", "git/encoded"},
+				Token:     "root-token",
+				CACertPEM: caCertPEM,
+			}
+		})
+
+		it("reads single and listed credentials with a token", func() {
+			client, err := git.NewVaultClient(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			credentials, err := client.ReadCredentials()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(Equal([]git.GitCredential{
+				{Protocol: "https", Host: "github.com", Path: "/", Username: "user", Password: "token"},
+				{Protocol: "https", Host: "gitlab.com", Path: "/group", Username: "a", Password: "b"},
+				{Protocol: "https", Host: "example.com", Path: "/", Username: "c", Password: "d"},
+			}))
+			Expect(namespaces).To(ConsistOf("team", "team", "team"))
+		})
+
+		it("logs in with AppRole", func() {
+			config.Token = ""
+			config.RoleID = "role"
+			config.SecretID = "secret"
+			config.Paths = []string{"git/github"}
+
+			client, err := git.NewVaultClient(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			credentials, err := client.ReadCredentials()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(HaveLen(1))
+		})
+
+		it("reports AppRole login failures", func() {
+			config.Token = ""
+			config.AuthMethod = "approle"
+			config.RoleID = "role"
+			config.SecretID = "wrong"
+
+			client, err := git.NewVaultClient(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.ReadCredentials()
+			Expect(err).To(MatchError("failed to log in to Vault with AppRole: Vault returned status 400: invalid role or secret ID"))
+		})
+
+		it("reports missing secrets", func() {
+			config.Paths = []string{"git/missing"}
+
+			client, err := git.NewVaultClient(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.ReadCredentials()
+			Expect(err).To(MatchError("failed to read Vault secret git/missing: Vault returned status 404"))
+		})
+
+		it("reports credentials without a host", func() {
+			config.Paths = []string{"git/hostless"}
+
+			client, err := git.NewVaultClient(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.ReadCredentials()
+			Expect(err).To(MatchError("credential #1 of Vault secret git/hostless does not specify a host"))
+		})
+
+		it("requires a token", func() {
+			config.Token = ""
+
+			client, err := git.NewVaultClient(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.ReadCredentials()
+			Expect(err).To(MatchError("Vault auth method token requires VAULT_TOKEN"))
+		})
+
+		it("does not trust the server without the CA certificate", func() {
+			config.CACertPEM = nil
+
+			client, err := git.NewVaultClient(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.ReadCredentials()
+			Expect(err).To(MatchError(ContainSubstring("certificate")))
+		})
+
+		it("rejects invalid CA certificates", func() {
+			config.CACertPEM = []byte("not a certificate")
+
+			_, err := git.NewVaultClient(config)
+			Expect(err).To(MatchError("Vault CA certificate does not contain any PEM encoded certificates"))
+		})
+	})
+}
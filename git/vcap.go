@@ -0,0 +1,135 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// VCAPServicesTag is the tag of Cloud Foundry service instances containing GIT
+// credentials
+const VCAPServicesTag = "git-credentials"
+
+// VCAPServiceInstance represents a service instance in VCAP_SERVICES
+type VCAPServiceInstance struct {
+	Name        string          `json:"name"`
+	Label       string          `json:"label"`
+	Tags        []string        `json:"tags"`
+	Credentials json.RawMessage `json:"credentials"`
+}
+
+// ParseVCAPServices returns all service instances of VCAP_SERVICES which are
+// either tagged with "git-credentials" or, if label is not empty, are
+// instances of the service with the given label
+func ParseVCAPServices(vcapServices string, label string) ([]VCAPServiceInstance, error) {
+	var services map[string][]VCAPServiceInstance
+	err := json.Unmarshal([]byte(vcapServices), &services)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse VCAP_SERVICES: %w", err)
+	}
+
+	// map iteration order is random, keep the order of instances stable
+	var labels []string
+	for serviceLabel := range services {
+		labels = append(labels, serviceLabel)
+	}
+	sort.Strings(labels)
+
+	var instances []VCAPServiceInstance
+	for _, serviceLabel := range labels {
+		for _, instance := range services[serviceLabel] {
+			if instance.matches(label) {
+				instances = append(instances, instance)
+			}
+		}
+	}
+
+	return instances, nil
+}
+
+// vcapServicesOf returns a VCAP_SERVICES document containing only the given
+// service instances
+func vcapServicesOf(instances []VCAPServiceInstance) (string, error) {
+	services := map[string][]VCAPServiceInstance{}
+	for _, instance := range instances {
+		services[instance.Label] = append(services[instance.Label], instance)
+	}
+
+	content, err := json.Marshal(services)
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// matches reports whether a service instance contains GIT credentials
+func (i VCAPServiceInstance) matches(label string) bool {
+	if label != "" && i.Label == label {
+		return true
+	}
+
+	for _, tag := range i.Tags {
+		if tag == VCAPServicesTag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GitCredentials maps the credentials of a service instance to GIT
+// credentials. The credentials may either be a single credential object, an
+// array of credential objects or an object with an array of credential
+// objects named "credentials". The protocol defaults to "https" and the path
+// to "/".
+func (i VCAPServiceInstance) GitCredentials() ([]GitCredential, error) {
+	gitCredentials, err := i.parseCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	for index := range gitCredentials {
+		if gitCredentials[index].Host == "" && gitCredentials[index].URL == "" && gitCredentials[index].Provider == "" {
+			return nil, fmt.Errorf("credential #%d of service instance %s does not specify a host", index+1, i.Name)
+		}
+
+		gitCredentials[index] = gitCredentials[index].WithDefaults()
+	}
+
+	return gitCredentials, nil
+}
+
+// parseCredentials decodes the credentials of a service instance
+func (i VCAPServiceInstance) parseCredentials() ([]GitCredential, error) {
+	credentials := bytes.TrimSpace(i.Credentials)
+	if len(credentials) == 0 {
+		return nil, fmt.Errorf("service instance %s does not contain credentials", i.Name)
+	}
+
+	var gitCredentials []GitCredential
+	if credentials[0] == '[' {
+		err := json.Unmarshal(credentials, &gitCredentials)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse credentials of service instance %s: %w", i.Name, err)
+		}
+		return gitCredentials, nil
+	}
+
+	var wrapped struct {
+		Credentials []GitCredential `json:"credentials"`
+	}
+	err := json.Unmarshal(credentials, &wrapped)
+	if err == nil && len(wrapped.Credentials) > 0 {
+		return wrapped.Credentials, nil
+	}
+
+	var gitCredential GitCredential
+	err = json.Unmarshal(credentials, &gitCredential)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse credentials of service instance %s: %w", i.Name, err)
+	}
+
+	return []GitCredential{gitCredential}, nil
+}
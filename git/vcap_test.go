@@ -0,0 +1,117 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/anynines/gitcredentials/git"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testVCAP(t *testing.T, context spec.G, it spec.S) {
+	var Expect = NewWithT(t).Expect
+
+	const vcapServices = `{
+  "user-provided": [
+    {
+      "name": "github",
+      "label": "user-provided",
+      "tags": ["git-credentials"],
+      "credentials": {"host": "github.com", "username": "user", "password": "token"}
+    },
+    {
+      "name": "database",
+      "label": "user-provided",
+      "tags": [],
+      "credentials": {"uri": "postgres://db"}
+    }
+  ],
+  "a9s-git": [
+    {
+      "name": "internal-git",
+      "label": "a9s-git",
+      "tags": [],
+      "credentials": {
+        "credentials": [
+          {"protocol": "https", "host": "git.example.com", "path": "/org", "username": "a", "password": "b"},
+          {"host": "git.example.com", "username": "git", "ssh_key": "key"}
+        ]
+      }
+    }
+  ]
+}`
+
+	context("ParseVCAPServices", func() {
+		it("returns instances tagged with git-credentials", func() {
+			instances, err := git.ParseVCAPServices(vcapServices, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(HaveLen(1))
+			Expect(instances[0].Name).To(Equal("github"))
+		})
+
+		it("returns instances with the configured label", func() {
+			instances, err := git.ParseVCAPServices(vcapServices, "a9s-git")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(instances).To(HaveLen(2))
+			Expect(instances[0].Name).To(Equal("internal-git"))
+			Expect(instances[1].Name).To(Equal("github"))
+		})
+
+		it("returns an error for invalid JSON", func() {
+			_, err := git.ParseVCAPServices("{", "")
+			Expect(err).To(MatchError(ContainSubstring("failed to parse VCAP_SERVICES")))
+		})
+	})
+
+	context("GitCredentials", func() {
+		it("maps a single credential object and applies defaults", func() {
+			instances, err := git.ParseVCAPServices(vcapServices, "")
+			Expect(err).NotTo(HaveOccurred())
+
+			credentials, err := instances[0].GitCredentials()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(Equal([]git.GitCredential{
+				{Protocol: "https", Host: "github.com", Path: "/", Username: "user", Password: "token"},
+			}))
+		})
+
+		it("maps an array of credential objects", func() {
+			instances, err := git.ParseVCAPServices(vcapServices, "a9s-git")
+			Expect(err).NotTo(HaveOccurred())
+
+			credentials, err := instances[0].GitCredentials()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(Equal([]git.GitCredential{
+				{Protocol: "https", Host: "git.example.com", Path: "/org", Username: "a", Password: "b"},
+				{Protocol: "ssh", Host: "git.example.com", Username: "git", SSHKey: "key"},
+			}))
+		})
+
+		it("maps a top-level array", func() {
+			instance := git.VCAPServiceInstance{
+				Name:        "array",
+				Credentials: []byte(`[{"host": "github.com", "username": "user", "password": "token"}]`),
+			}
+
+			credentials, err := instance.GitCredentials()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credentials).To(HaveLen(1))
+		})
+
+		it("returns an error if a credential does not specify a host", func() {
+			instance := git.VCAPServiceInstance{
+				Name:        "hostless",
+				Credentials: []byte(`{"username": "user", "password": "token"}`),
+			}
+
+			_, err := instance.GitCredentials()
+			Expect(err).To(MatchError("credential #1 of service instance hostless does not specify a host"))
+		})
+
+		it("returns an error if the instance does not contain credentials", func() {
+			_, err := git.VCAPServiceInstance{Name: "empty"}.GitCredentials()
+			Expect(err).To(MatchError("service instance empty does not contain credentials"))
+		})
+	})
+}
@@ -29,6 +29,7 @@ function main() {
 
   run::build
   cmd::build
+  cleanup::build
 }
 
 function usage() {
@@ -85,4 +86,30 @@ function cmd::build() {
   fi
 }
 
+function cleanup::build() {
+  if [[ -f "${BUILDPACKDIR}/cleanup/run/main.go" ]]; then
+    mkdir -p "${BUILDPACKDIR}/cleanup/bin"
+
+    pushd "${BUILDPACKDIR}/cleanup/bin" > /dev/null || return
+      printf "%s" "Building cleanup... "
+
+      GOOS=linux \
+        go build \
+          -ldflags="-s -w" \
+          -o "run" \
+            "${BUILDPACKDIR}/cleanup/run"
+
+      echo "Success!"
+
+      for name in detect build; do
+        printf "%s" "Linking cleanup ${name}... "
+
+        ln -sf "run" "${name}"
+
+        echo "Success!"
+      done
+    popd > /dev/null || return
+  fi
+}
+
 main "${@:-}"
@@ -57,6 +57,7 @@ function main {
   repo::prepare
   buildpack::archive "${version}"
   buildpackage::create "${output}"
+  cleanup::package "${version}" "$(dirname "${output}")/cleanup-buildpackage.cnb"
 }
 
 function usage() {
@@ -121,4 +122,26 @@ function buildpackage::create() {
       --format file
 }
 
+function cleanup::package() {
+  local version output
+  version="${1}"
+  output="${2}"
+
+  util::print::title "Packaging cleanup buildpack into ${output}..."
+
+  # jam runs pre-package scripts in a copy of the buildpack directory, which
+  # lacks the Go module of the repository, so the executables are built here
+  "${ROOT_DIR}/scripts/build.sh"
+
+  jam pack \
+    --buildpack "${ROOT_DIR}/cleanup/buildpack.toml" \
+    --version "${version}" \
+    --output "${BUILD_DIR}/cleanup-buildpack.tgz"
+
+  pack \
+    buildpack package "${output}" \
+      --path "${BUILD_DIR}/cleanup-buildpack.tgz" \
+      --format file
+}
+
 main "${@:-}"